@@ -2,18 +2,32 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	// timezones are embedded for hosts without a timezone database, such as Windows
+	_ "time/tzdata"
 
 	"log"
 
 	"bufio"
+	"net"
+	"net/http"
 
 	"github.com/golang/glog"
 	"github.com/mchestr/ethos-monitor/mining_monitor"
 )
 
+// serviceCommands are the commands managing the Windows service, given as the first argument after the flags.
+var serviceCommands = map[string]bool{"install": true, "remove": true, "start": true, "stop": true}
+
 var (
 	debug                  = flag.Bool("debug", false, "Used for debugging to set clients to READONLY mode")
 	checkFailsBeforeReboot = flag.Int("check-fails", 2, "Number of failed checks before reboot, default 2")
@@ -21,17 +35,87 @@ var (
 	statsInterval          = flag.Duration("stats-interval", 30*time.Second, "Interval to poll for statistics")
 	stateInterval          = flag.Duration("state-interval", 3*time.Second, "Time in seconds to transition monitoring states")
 	rebootInterval         = flag.Duration("reboot-interval", 5*time.Minute, "Time between successful reboots before attempting another")
+	rebootSchedule         = flag.String("reboot-schedule", "", "Cron schedule to reboot the rig preventively e.g. \"0 4 * * 0\" for Sundays at 4am, in the -timezone unless prefixed with CRON_TZ=<zone>")
+	rebootScheduleSkip     = flag.Duration("reboot-schedule-skip", 24*time.Hour, "Skip a scheduled reboot if the rig restarted within this duration")
 
 	claymoreAddress  = flag.String("claymore-address", "", "Address for claymore remote management interface")
 	claymorePassword = flag.String("claymore-password", "", "Password for claymore remote management interface")
 	claymoreVersion  = flag.Float64("claymore-version", 10.2, "Claymore version")
 
-	hashThreshold        = flag.String("hash-threshold", "<23000", "Threshold in kH/s per GPU if below will attempt reboot")
+	miner            = flag.String("miner", "claymore", "Miner to monitor, claymore|antminer|simulated|replay|plugin")
+	antminerAddress  = flag.String("antminer-address", "", "Address for antminer cgminer API e.g. 192.168.1.10:4028")
+	antminerUser     = flag.String("antminer-user", "root", "Username for antminer web interface")
+	antminerPassword = flag.String("antminer-password", "root", "Password for antminer web interface")
+	scenario         = flag.String("scenario", "", "Scenario file for the simulated miner")
+	scenarioSpeed    = flag.Float64("scenario-speed", 1, "How many times faster than real time the simulated miner scenario runs")
+	replay           = flag.String("replay", "", "Stats recording for the replay miner")
+	replayClient     = flag.String("replay-client", "", "Client to replay from a stats recording of several clients")
+	replaySpeed      = flag.Float64("replay-speed", 60, "How many times faster than recorded the replay miner runs, the client is monitored on the replay time")
+	clientPlugin     = flag.String("client-plugin", "", "Client plugin command for the plugin miner e.g. \"/usr/local/bin/my-miner-plugin --addr 192.168.1.10\"")
+	record           = flag.String("record", "", "File to record every stats poll to, for use with the replay miner")
+	recordEvents     = flag.String("record-events", "", "File to record every event to, for the remediation history of reports")
+
+	hashThreshold        = flag.String("hash-threshold", "<23000", "Threshold in kH/s per GPU if below will attempt reboot, or relative to the expected hashrate of the GPU model e.g. <expected*0.9")
 	powerThreshold       = flag.String("power-threshold", "", "Threshold in Watts for Rig")
 	temperatureThreshold = flag.String("temp-threshold", "", "Threshold in degrees celsius for GPUs")
 	fanPercentThreshold  = flag.String("fan-threshold", ">70", "Threshold in percent for GPUs")
+	memoryErrorThreshold = flag.String("memory-error-threshold", "", "Threshold for new GPU ECC errors or retired pages per hour, requires GPU stats")
+	pcieLinkCheck        = flag.Bool("pcie-link-check", false, "Alarm when a GPU PCIe link width or generation drops below the best seen since startup, requires GPU stats")
+
+	hostStats           = flag.Bool("host-stats", false, "Collect host load, memory, disk, temperature and network statistics over SSH")
+	hostLoadThreshold   = flag.String("host-load-threshold", "", "Threshold for the 5 minute host load average")
+	hostMemoryThreshold = flag.String("host-memory-threshold", ">90", "Threshold in percent of host memory used")
+	diskThreshold       = flag.String("disk-threshold", ">90", "Threshold in percent of disk space used")
+	hostTempThreshold   = flag.String("host-temp-threshold", "", "Threshold in degrees celsius for host thermal zones")
+	netErrorThreshold   = flag.String("net-error-threshold", "", "Threshold for new network interface errors per hour")
+
+	boardHashThreshold    = flag.String("board-hash-threshold", "", "Threshold in GH/s per ASIC hashboard if below will attempt reboot, or relative to the expected hashrate of the miner model e.g. <expected*0.9")
+	boardTempThreshold    = flag.String("board-temp-threshold", ">90", "Threshold in degrees celsius for ASIC hashboards")
+	boardChipThreshold    = flag.String("board-chip-threshold", "<1", "Threshold for chips detected per ASIC hashboard if below will attempt reboot, by default only dead boards")
+	boardHwErrorThreshold = flag.String("board-hw-error-threshold", "", "Threshold for new hardware errors per ASIC hashboard per hour")
+
+	algorithm         = flag.String("algorithm", "", "Comma separated algorithms mined, main first e.g. ethash,blake2s when dual mining, defaults to sha256 for antminers and ethash otherwise")
+	algorithmHash     = flag.String("algorithm-hash-threshold", "", "Comma separated algorithm=threshold hashrates per GPU when dual mining e.g. blake2s=<1000000")
+	algorithmReject   = flag.String("algorithm-reject-threshold", "", "Comma separated algorithm=threshold percentages of rejected shares e.g. ethash=>5,blake2s=>5")
+	hashRateOverrides = flag.String("hashrate-overrides", "", "CSV file of model,algorithm,hashrate lines overriding or adding to the built in expected hashrates")
+
+	coins                = flag.String("coins", "", "Comma separated algorithm=coin:coinsPerHashRate rewards to estimate revenue with, coins are CoinGecko IDs e.g. ethash=ethereum:0.00000004 for coins per day per kH/s")
+	currency             = flag.String("currency", "usd", "Currency coin prices and revenue are in")
+	priceInterval        = flag.Duration("price-interval", 15*time.Minute, "Interval to refresh coin prices")
+	powerPrice           = flag.Float64("power-price", 0, "Price of electricity per kWh in -currency, to estimate power costs with")
+	revenueDropThreshold = flag.String("revenue-drop-threshold", "", "Threshold in percent revenue per day may drop below its -revenue-drop-window average, requires -coins")
+	revenueDropWindow    = flag.Duration("revenue-drop-window", 24*time.Hour, "Window revenue drops are measured against")
+
+	smart          = flag.Bool("smart", false, "Check SMART health of the rig boot drive over SSH")
+	smartDevice    = flag.String("smart-device", "", "Drive to check SMART health of, defaults to the drive / is mounted from")
+	smartInterval  = flag.Duration("smart-interval", 1*time.Hour, "Interval to read SMART attributes")
+	smartThreshold = flag.String("smart-threshold", ">0", "Threshold for reallocated, pending or uncorrectable sectors")
+
+	expectWallet      = flag.String("expect-wallet", "", "Comma separated wallets the miner must be configured to mine to, alarms critically otherwise")
+	expectPool        = flag.String("expect-pool", "", "Comma separated pools e.g. nanopool.org the miner must be configured to mine to, alarms critically otherwise")
+	poolCheckInterval = flag.Duration("pool-check-interval", 10*time.Minute, "Interval to read the pools and wallets configured on the miner")
 
 	hs110PlugIp = flag.String("hs110plug-ip", "", "TPLink HS110 plug IP")
+	powerPlugin = flag.String("power-plugin", "", "Power plugin command used instead of the HS110 plug e.g. \"/usr/local/bin/my-pdu-plugin --outlet 3\"")
+	sinkPlugins = flag.String("sink-plugins", "", "Semicolon separated event sink plugin commands every event is forwarded to")
+
+	sshAddress  = flag.String("ssh-address", "", "SSH address of the rig, defaults to the miner host on port 22")
+	sshUser     = flag.String("ssh-user", "ethos", "SSH user for the rig")
+	sshPassword = flag.String("ssh-password", "", "SSH password for the rig")
+	sshKey      = flag.String("ssh-key", "", "SSH private key file for the rig")
+	gpuVendor   = flag.String("gpu-vendor", "nvidia", "GPU vendor of the rig used for GPU control actions, nvidia|amd|intel")
+
+	gpuStats = flag.Bool("gpu-stats", false, "Collect GPU temperatures, power, memory errors and PCIe links over SSH, enabled by any GPU action or threshold")
+
+	fanCurve = flag.String("fan-curve", "", "Fan curve as temperature:percent pairs e.g. 65:70,75:90,80:100, applied before rebooting")
+
+	powerLimitTemp = flag.Float64("power-limit-temp", 0, "Soft GPU core/memory temperature limit in degrees celsius above which the power limit is lowered")
+	powerLimitStep = flag.Float64("power-limit-step", 10, "Watts to lower/raise a GPU power limit by per stats poll")
+	powerLimitMin  = flag.Float64("power-limit-min", 100, "Minimum GPU power limit in Watts")
+
+	kernelLog           = flag.Bool("kernel-log", false, "Watch the rig kernel log over SSH for GPU errors")
+	kernelLogPattern    = flag.String("kernel-log-pattern", mining_monitor.DefaultKernelErrorPattern, "Regular expression matching critical kernel log lines")
+	kernelLogPowerCycle = flag.Bool("kernel-log-power-cycle", false, "Power cycle immediately when a critical kernel log line is found, otherwise reboot immediately")
 
 	emailEnabled  = flag.Bool("email-enabled", true, "Enable/Disable email flag")
 	email         = flag.String("email", "", "Email to send from")
@@ -39,37 +123,231 @@ var (
 	emailPassword = flag.String("email-password", "", "Email Pass")
 	emailPort     = flag.Int("email-port", 25, "Email port, default 25")
 
+	firmwareImage     = flag.String("firmware-update", "", "Firmware image to flash to the -firmware-targets in batches before exiting, instead of monitoring")
+	firmwareRollback  = flag.String("firmware-rollback", "", "Firmware image to flash to targets which fail to recover from the update")
+	firmwareTargets   = flag.String("firmware-targets", "", "Comma separated cgminer API addresses of the miners to update, defaults to -antminer-address")
+	firmwareVendor    = flag.String("firmware-vendor", "antminer", "Vendor of the miners to update, antminer|whatsminer, whatsminers are flashed over SSH")
+	configPush        = flag.String("config-push", "", "Miner config file to push to the -config-targets in stages before exiting, instead of monitoring")
+	configPushVia     = flag.String("config-push-via", "claymore", "How configs are pushed, claymore|ssh|hiveos, hiveos applies the -hiveos-flight-sheet instead of a file")
+	configFileName    = flag.String("config-file-name", "", "Claymore miner directory file replaced by the pushed config e.g. epools.txt, defaults to the name of the -config-push file")
+	configSSHPath     = flag.String("config-ssh-path", "/home/ethos/local.conf", "Config file on the rig replaced by the pushed config over SSH")
+	configSSHRestart  = flag.String("config-ssh-restart", "minestop; minestart", "Command restarting the miner after its config is replaced over SSH")
+	configTargets     = flag.String("config-targets", "", "Rigs to push config to in stages as stage=addr,addr;stage=addr, hiveos targets are addr@workerID, defaults to the miner address")
+	configExpectPool  = flag.String("config-expect-pool", "", "Pool rigs must be mining to after the push e.g. eth-us-east1.nanopool.org")
+	hiveOSToken       = flag.String("hiveos-token", "", "HiveOS API token")
+	hiveOSFarm        = flag.Int("hiveos-farm", 0, "HiveOS farm ID")
+	hiveOSFlightSheet = flag.Int("hiveos-flight-sheet", 0, "HiveOS flight sheet ID to apply")
+	rolloutBatchSize  = flag.Int("rollout-batch-size", 1, "Number of miners updated at a time")
+	rolloutTimeout    = flag.Duration("rollout-timeout", 20*time.Minute, "Time for an updated miner to restart and pass its thresholds before it is rolled back")
+
+	benchmarkProfiles = flag.String("benchmark-profiles", "", "OC profiles to benchmark the rig with before exiting, instead of monitoring, as name=powerLimit[/coreOffset/memoryOffset],...")
+	benchmarkDuration = flag.Duration("benchmark-duration", 10*time.Minute, "Time each OC profile is sampled for")
+	benchmarkWarmup   = flag.Duration("benchmark-warmup", 2*time.Minute, "Time given to each OC profile to settle before sampling")
+
+	timezone = flag.String("timezone", "", "IANA timezone of the site e.g. America/Edmonton that schedules are evaluated in, defaults to the local timezone")
+
+	reportSchedule = flag.String("report-schedule", "", "Cron schedule to email an operations report of the time since the last one e.g. \"0 8 * * 1\" for weekly, requires -record")
+	reportPDF      = flag.Bool("report-pdf", false, "Attach a PDF of the report, requires wkhtmltopdf")
+
+	healthAddress = flag.String("health-address", "", "Address to serve /livez and /readyz probes on e.g. :8080, disabled if empty")
+	drainTimeout  = flag.Duration("drain-timeout", 25*time.Second, "Time to wait on SIGTERM for in-flight reboots and events to finish before exiting")
+
 	emailMaxInterval = flag.Int("email-max-interval", 5, "Max emails to send in email-timeout duration")
 	emailTimeout     = flag.Duration("emailTimeout", 1*time.Hour, "Time between sending emails if maximum is reached")
 )
 
 func main() {
 	flag.Parse()
+	log.SetOutput(os.Stdout)
+
+	if flag.NArg() > 0 && serviceCommands[flag.Arg(0)] {
+		// flags given before the command are kept for the service to be started with
+		if err := runServiceCommand(flag.Arg(0), os.Args[1:len(os.Args)-flag.NArg()]); err != nil {
+			log.Fatalf("%s failed: %s", flag.Arg(0), err)
+		}
+		return
+	}
+	if *firmwareImage != "" {
+		if err := runFirmwareUpdate(); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+	if *benchmarkProfiles != "" {
+		if err := runBenchmark(); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+	if *configPush != "" || *hiveOSFlightSheet != 0 {
+		if err := runConfigPush(); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+	isService, err := isWindowsService()
+	if err != nil {
+		panic(err)
+	}
+	if isService {
+		runService()
+		return
+	}
+
 	s := make(chan os.Signal, 1)
 	in := make(chan string)
-	signal.Notify(s, os.Interrupt)
-	log.SetOutput(os.Stdout)
+	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
+	m, c, closers := newMonitor()
 
-	var eventService *mining_monitor.EventService
-	if *emailEnabled {
-		es := mining_monitor.NewGMailService(*emailHost, *email, []string{*email}, *email, *emailPassword, *emailPort)
-		es.SetMaxEmails(*emailMaxInterval, *emailTimeout)
-		eventService = mining_monitor.NewEventServiceWithEmail(es)
-	} else {
-		eventService = mining_monitor.NewEventService()
+	if err := startMonitor(m); err != nil {
+		log.Fatalf("%s", err)
+	}
+	if _, err := mining_monitor.SdNotify("READY=1"); err != nil {
+		log.Printf("%s", err)
+	}
+	watchdogStop := make(chan struct{})
+	go func() {
+		if err := mining_monitor.RunSdWatchdog(m, watchdogStop); err != nil {
+			log.Printf("systemd watchdog disabled: %s", err)
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			input := scanner.Text()
+			in <- input
+		}
+	}()
+
+	glog.Info("Mining Monitor running\nCommands:\nstop|s - stop the monitoring\nresume|r - resume the monitoring\ndebug|d - enable debugging\n\n")
+	for {
+		select {
+		case inputStr := <-in:
+			switch inputStr {
+			case "stop", "s":
+				log.Printf("Stopping monitoring service...")
+				m.Stop()
+				log.Printf("Monitoring service stoppped")
+			case "resume", "r":
+				log.Printf("Starting monitoring service...")
+				m.Start()
+				log.Printf("Monitoring service started")
+			case "debug", "d":
+				log.Printf("Setting client to debug %t", !c.ReadOnly())
+				c.SetReadOnly(!c.ReadOnly(), false)
+			}
+		case <-s:
+			mining_monitor.SdNotify("STOPPING=1")
+			close(watchdogStop)
+			drainMonitor(m, closers)
+			log.Println("Exitting Program.")
+			glog.Flush()
+			return
+		}
+	}
+}
+
+// startMonitor starts the monitor and, if -health-address is set, serves its health probes. It is shared by the
+// console and the Windows service.
+func startMonitor(m *mining_monitor.Monitor) error {
+	if err := m.Start(); err != nil {
+		return err
 	}
+	if *healthAddress == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", *healthAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for health probes on %s: %s", *healthAddress, err)
+	}
+	go func() {
+		if err := http.Serve(l, mining_monitor.NewHealthHandler(m)); err != nil {
+			log.Printf("health server failed: %s", err)
+		}
+	}()
+	return nil
+}
 
+// drainMonitor stops the monitor, waiting up to -drain-timeout for in-flight remediations and events to finish, and
+// then closes the recordings. It is shared by the console and the Windows service.
+func drainMonitor(m *mining_monitor.Monitor, closers []io.Closer) {
+	drained := make(chan bool)
+	go func() {
+		m.Stop()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(*drainTimeout):
+		log.Printf("Timed out after %s waiting for monitoring to stop", *drainTimeout)
+	}
+	closeAll(closers)
+}
+
+// closeAll closes every closer, logging the ones which fail.
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Printf("%s", err)
+		}
+	}
+}
+
+// newClient creates the client of the -miner type.
+func newClient() mining_monitor.Client {
 	ps := mining_monitor.NewHS110PowerService(*hs110PlugIp)
-	c := mining_monitor.NewClaymoreClientWithPowerService(*claymoreAddress, *claymorePassword, *claymoreVersion, ps)
+	var c mining_monitor.Client
+	var err error
+	if *powerPlugin != "" {
+		path, args := pluginCommand(*powerPlugin)
+		if ps, err = mining_monitor.NewPluginPowerService(path, args...); err != nil {
+			panic(err)
+		}
+	}
+	switch *miner {
+	case "claymore":
+		c = mining_monitor.NewClaymoreClientWithPowerService(*claymoreAddress, *claymorePassword, *claymoreVersion, ps)
+	case "antminer":
+		c = mining_monitor.NewAntminerClientWithPowerService(*antminerAddress, *antminerUser, *antminerPassword, ps)
+	case "simulated":
+		sc, err := mining_monitor.LoadScenario(*scenario)
+		if err != nil {
+			panic(err)
+		}
+		c = mining_monitor.NewSimulatedClient(*scenario, sc, *scenarioSpeed)
+	case "replay":
+		c, err = mining_monitor.NewReplayClient(*replay, *replayClient, *replaySpeed)
+		if err != nil {
+			panic(err)
+		}
+	case "plugin":
+		path, args := pluginCommand(*clientPlugin)
+		c, err = mining_monitor.NewPluginClient(path, args...)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic(fmt.Errorf("unknown miner %s, must be one of claymore|antminer|simulated|replay|plugin", *miner))
+	}
 	c.SetReadOnly(*debug, true)
+	return c
+}
+
+// newMonitor creates the monitor and client configured by the command line flags, and the recordings which must be
+// closed once the monitor has stopped.
+func newMonitor() (*mining_monitor.Monitor, mining_monitor.Client, []io.Closer) {
+	var closers []io.Closer
+	eventService := newEventService()
+	c := newClient()
 
 	m := mining_monitor.NewMonitor(eventService)
 
-	hashThreshold, err := mining_monitor.NewHashRateThreshold(*hashThreshold, true, false)
+	hashRateThreshold, err := newHashRateThreshold()
 	if err != nil {
 		panic(err)
 	}
-	thresholds := []*mining_monitor.Threshold{hashThreshold}
+	thresholds := []*mining_monitor.Threshold{hashRateThreshold}
 	if *powerThreshold != "" {
 		powerThreshold, err := mining_monitor.NewPowerThreshold(*powerThreshold, true, false)
 		if err != nil {
@@ -91,43 +369,532 @@ func main() {
 		}
 		thresholds = append(thresholds, fpThreshold)
 	}
-	m.AddClient(c, mining_monitor.NewClientMonitorConfig(
+	if *memoryErrorThreshold != "" {
+		meThreshold, err := mining_monitor.NewMemoryErrorThreshold(*memoryErrorThreshold, false, true)
+		if err != nil {
+			panic(err)
+		}
+		thresholds = append(thresholds, meThreshold)
+	}
+	if *pcieLinkCheck {
+		pcieThreshold, err := mining_monitor.NewPcieLinkThreshold(false, true)
+		if err != nil {
+			panic(err)
+		}
+		thresholds = append(thresholds, pcieThreshold)
+	}
+	var actions []*mining_monitor.Action
+	collectors := []mining_monitor.Collector{mining_monitor.NewAlgorithmCollector(miningAlgorithms())}
+	thresholds = append(thresholds, algorithmThresholds(*algorithmHash, mining_monitor.NewAlgorithmHashRateThreshold, true)...)
+	thresholds = append(thresholds, algorithmThresholds(*algorithmReject, mining_monitor.NewAlgorithmRejectedSharesThreshold, false)...)
+	if *coins != "" {
+		rewards, err := mining_monitor.ParseCoinRewards(*coins)
+		if err != nil {
+			panic(err)
+		}
+		ps := mining_monitor.NewCoinGeckoPriceSource(*currency)
+		// every client added to the monitor shares the fleet, so each reports the revenue of them all
+		fleet := mining_monitor.NewRevenueFleet()
+		collectors = append(collectors, mining_monitor.NewRevenueCollector(c, ps, *currency, rewards, *powerPrice, *priceInterval, fleet))
+		if *revenueDropThreshold != "" {
+			revenueThreshold, err := mining_monitor.NewRevenueDropThreshold(*revenueDropThreshold, *revenueDropWindow, false, true)
+			if err != nil {
+				panic(err)
+			}
+			thresholds = append(thresholds, revenueThreshold)
+		}
+	}
+	// GPU models are needed to look up the hashrate expected of each GPU
+	expectedGpuHashRates := mining_monitor.IsExpectedThreshold(*hashThreshold) && *miner == "claymore"
+	if *gpuStats || *fanCurve != "" || *powerLimitTemp > 0 || *memoryErrorThreshold != "" || *pcieLinkCheck || expectedGpuHashRates {
+		gs, err := newGpuService()
+		if err != nil {
+			panic(err)
+		}
+		collectors = append(collectors, gs)
+		if *fanCurve != "" {
+			fanAction, err := mining_monitor.NewFanCurveAction(*fanCurve, gs)
+			if err != nil {
+				panic(err)
+			}
+			actions = append(actions, fanAction)
+		}
+		if *powerLimitTemp > 0 {
+			plAction, err := mining_monitor.NewPowerLimitAction(*powerLimitTemp, *powerLimitStep, *powerLimitMin, gs)
+			if err != nil {
+				panic(err)
+			}
+			actions = append(actions, plAction)
+		}
+	}
+	if *hostStats {
+		sh, err := newShellService()
+		if err != nil {
+			panic(err)
+		}
+		collectors = append(collectors, mining_monitor.NewHostCollector(sh))
+		thresholds = append(thresholds, newThresholds(
+			thresholdFlag{*hostLoadThreshold, mining_monitor.NewHostLoadThreshold, false},
+			thresholdFlag{*hostMemoryThreshold, mining_monitor.NewHostMemoryThreshold, false},
+			thresholdFlag{*diskThreshold, mining_monitor.NewDiskUsageThreshold, false},
+			thresholdFlag{*hostTempThreshold, mining_monitor.NewHostTemperatureThreshold, false},
+			thresholdFlag{*netErrorThreshold, mining_monitor.NewNetErrorThreshold, false},
+		)...)
+	}
+	if *miner == "antminer" {
+		thresholds = append(thresholds, boardThresholds()...)
+	}
+	if *expectWallet != "" || *expectPool != "" {
+		poolCollector, err := mining_monitor.NewPoolConfigCollector(c, *poolCheckInterval)
+		if err != nil {
+			panic(err)
+		}
+		collectors = append(collectors, poolCollector)
+		thresholds = append(thresholds, newThresholds(
+			thresholdFlag{*expectWallet, mining_monitor.NewWalletThreshold, false},
+			thresholdFlag{*expectPool, mining_monitor.NewPoolThreshold, false},
+		)...)
+	}
+	if *smart {
+		sh, err := newShellService()
+		if err != nil {
+			panic(err)
+		}
+		collectors = append(collectors, mining_monitor.NewSmartCollector(sh, *smartDevice, *smartInterval))
+		smartThreshold, err := mining_monitor.NewSmartThreshold(*smartThreshold, false, true)
+		if err != nil {
+			panic(err)
+		}
+		thresholds = append(thresholds, smartThreshold)
+	}
+	if *kernelLog {
+		sh, err := newShellService()
+		if err != nil {
+			panic(err)
+		}
+		klCollector, err := mining_monitor.NewKernelLogCollector(sh, *kernelLogPattern)
+		if err != nil {
+			panic(err)
+		}
+		collectors = append(collectors, klCollector)
+		klThreshold, err := mining_monitor.NewKernelErrorThreshold(*kernelLogPowerCycle, true)
+		if err != nil {
+			panic(err)
+		}
+		thresholds = append(thresholds, klThreshold)
+	}
+	config := mining_monitor.NewClientMonitorConfig(
 		thresholds, *checkFailsBeforeReboot, *rebootFailsBeforePower,
 		*rebootInterval, *statsInterval, *stateInterval,
-	))
+	)
+	config.Actions = actions
+	config.Collectors = collectors
+	if rc, ok := c.(*mining_monitor.ReplayClient); ok {
+		config.Clock = rc.Clock()
+	}
+	if *rebootSchedule != "" {
+		schedule, err := newSchedule(*rebootSchedule)
+		if err != nil {
+			panic(err)
+		}
+		config.RebootSchedule = schedule
+		config.RebootScheduleSkip = *rebootScheduleSkip
+	}
+	if *record != "" {
+		recorder, err := mining_monitor.NewStatsRecorder(*record)
+		if err != nil {
+			panic(err)
+		}
+		config.Recorder = recorder
+		closers = append(closers, recorder)
+	}
+	if *recordEvents != "" {
+		recorder, err := mining_monitor.NewEventRecorder(*recordEvents)
+		if err != nil {
+			panic(err)
+		}
+		m.EventService.AddSink(recorder)
+		closers = append(closers, recorder)
+	}
+	if *reportSchedule != "" {
+		if *record == "" {
+			panic(fmt.Errorf("-report-schedule requires -record"))
+		}
+		schedule, err := newSchedule(*reportSchedule)
+		if err != nil {
+			panic(err)
+		}
+		m.Scheduler = mining_monitor.NewScheduler()
+		m.Scheduler.Add("report", schedule, mining_monitor.NewReportJob(c, m.EventService, schedule, *record, *recordEvents, *reportPDF))
+	}
+	m.AddClient(c, config)
+	return m, c, closers
+}
 
-	m.Start()
+func newSchedule(spec string) (*mining_monitor.Schedule, error) {
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s: %s", *timezone, err)
+	}
+	if *timezone == "" {
+		loc = time.Local
+	}
+	return mining_monitor.ParseSchedule(spec, loc)
+}
 
-	go func() {
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			input := scanner.Text()
-			in <- input
+func newEventService() *mining_monitor.EventService {
+	eventService := mining_monitor.NewEventService()
+	if *emailEnabled {
+		es := mining_monitor.NewGMailService(*emailHost, *email, []string{*email}, *email, *emailPassword, *emailPort)
+		es.SetMaxEmails(*emailMaxInterval, *emailTimeout)
+		eventService = mining_monitor.NewEventServiceWithEmail(es)
+	}
+	if *sinkPlugins != "" {
+		for _, command := range strings.Split(*sinkPlugins, ";") {
+			path, args := pluginCommand(command)
+			sink, err := mining_monitor.NewPluginEventSink(path, args...)
+			if err != nil {
+				panic(err)
+			}
+			eventService.AddSink(sink)
 		}
-	}()
+	}
+	return eventService
+}
 
-	glog.Info("Mining Monitor running\nCommands:\nstop|s - stop the monitoring\nresume|r - resume the monitoring\ndebug|d - enable debugging\n\n")
-	for {
-		select {
-		case inputStr := <-in:
-			switch inputStr {
-			case "stop", "s":
-				log.Printf("Stopping monitoring service...")
-				m.Stop()
-				log.Printf("Monitoring service stoppped")
-			case "resume", "r":
-				log.Printf("Starting monitoring service...")
-				m.Start()
-				log.Printf("Monitoring service started")
-			case "debug", "d":
-				log.Printf("Setting client to debug %t", !c.ReadOnly())
-				c.SetReadOnly(!c.ReadOnly(), false)
+// pluginCommand splits a plugin command into the plugin path and its arguments.
+func pluginCommand(command string) (string, []string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		panic(fmt.Errorf("empty plugin command"))
+	}
+	return fields[0], fields[1:]
+}
+
+func boardThresholds() []*mining_monitor.Threshold {
+	return newThresholds(
+		thresholdFlag{*boardHashThreshold, newBoardHashRateThreshold, true},
+		thresholdFlag{*boardTempThreshold, mining_monitor.NewBoardTemperatureThreshold, false},
+		thresholdFlag{*boardChipThreshold, mining_monitor.NewBoardChipThreshold, true},
+		thresholdFlag{*boardHwErrorThreshold, mining_monitor.NewBoardHardwareErrorThreshold, false},
+	)
+}
+
+// runFirmwareUpdate flashes the firmware image to every target in batches, verifying each against the board
+// thresholds before and after.
+func runFirmwareUpdate() error {
+	targets := *firmwareTargets
+	if targets == "" {
+		targets = *antminerAddress
+	}
+	var clients []mining_monitor.Client
+	for _, addr := range strings.Split(targets, ",") {
+		addr = strings.TrimSpace(addr)
+		var c mining_monitor.Client
+		switch *firmwareVendor {
+		case "antminer":
+			c = mining_monitor.NewAntminerClient(addr, *antminerUser, *antminerPassword)
+		case "whatsminer":
+			c = mining_monitor.NewWhatsminerClient(addr)
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return fmt.Errorf("invalid firmware target %s: %s", addr, err)
 			}
-		case <-s:
-			m.Stop()
-			log.Println("Exitting Program.")
-			time.Sleep(2 * time.Second)
-			return
+			sh, err := mining_monitor.NewSSHShellService(net.JoinHostPort(host, "22"), *sshUser, *sshPassword, *sshKey)
+			if err != nil {
+				return err
+			}
+			c = mining_monitor.NewFirmwareClient(c, mining_monitor.NewSysupgradeFirmwareUpdater(sh))
+		default:
+			return fmt.Errorf("unknown firmware vendor %s, must be one of antminer|whatsminer", *firmwareVendor)
+		}
+		c.SetReadOnly(*debug, true)
+		clients = append(clients, c)
+	}
+	eventService := newEventService()
+	go eventService.Start()
+	defer eventService.Stop()
+	rollout := mining_monitor.NewFirmwareRollout(*firmwareImage, *firmwareRollback, *rolloutBatchSize, boardThresholds(),
+		*rolloutTimeout, eventService)
+	return rollout.Run(clients)
+}
+
+// runConfigPush pushes the config to every target stage by stage, verifying each rig reconnects after the push.
+func runConfigPush() error {
+	var data []byte
+	name := fmt.Sprintf("flight sheet %d", *hiveOSFlightSheet)
+	if *configPushVia != "hiveos" {
+		var err error
+		if data, err = ioutil.ReadFile(*configPush); err != nil {
+			return fmt.Errorf("failed to read config %s: %s", *configPush, err)
+		}
+		name = *configPush
+	}
+	targets := *configTargets
+	if targets == "" {
+		targets = "all=" + minerAddress()
+	}
+	var stages []mining_monitor.RolloutStage
+	for _, stageTargets := range strings.Split(targets, ";") {
+		parts := strings.SplitN(stageTargets, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid config targets %s, expected stage=addr,addr", stageTargets)
+		}
+		stage := mining_monitor.RolloutStage{Name: strings.TrimSpace(parts[0])}
+		for _, addr := range strings.Split(parts[1], ",") {
+			addr = strings.TrimSpace(addr)
+			workerID := 0
+			if i := strings.LastIndex(addr, "@"); i >= 0 {
+				id, err := strconv.Atoi(addr[i+1:])
+				if err != nil {
+					return fmt.Errorf("invalid hiveos worker ID in %s: %s", addr, err)
+				}
+				addr, workerID = addr[:i], id
+			}
+			c, err := newRolloutClient(addr)
+			if err != nil {
+				return err
+			}
+			var p mining_monitor.ConfigPusher
+			switch *configPushVia {
+			case "claymore":
+				file := *configFileName
+				if file == "" {
+					file = filepath.Base(*configPush)
+				}
+				if p, err = mining_monitor.NewClaymoreConfigPusher(c, file, data); err != nil {
+					return err
+				}
+			case "ssh":
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					return fmt.Errorf("invalid config target %s: %s", addr, err)
+				}
+				sh, err := mining_monitor.NewSSHShellService(net.JoinHostPort(host, "22"), *sshUser, *sshPassword, *sshKey)
+				if err != nil {
+					return err
+				}
+				p = mining_monitor.NewSSHConfigPusher(sh, *configSSHPath, data, *configSSHRestart)
+			case "hiveos":
+				if workerID == 0 {
+					return fmt.Errorf("hiveos config target %s requires a worker ID as addr@workerID", addr)
+				}
+				p = mining_monitor.NewHiveOSConfigPusher(*hiveOSToken, *hiveOSFarm, workerID, *hiveOSFlightSheet)
+			default:
+				return fmt.Errorf("unknown config push method %s, must be one of claymore|ssh|hiveos", *configPushVia)
+			}
+			stage.Clients = append(stage.Clients, mining_monitor.NewConfigClient(c, p))
+		}
+		stages = append(stages, stage)
+	}
+	thresholds, err := newRolloutThresholds()
+	if err != nil {
+		return err
+	}
+	eventService := newEventService()
+	go eventService.Start()
+	defer eventService.Stop()
+	rollout := mining_monitor.NewConfigRollout(name, *configExpectPool, *rolloutBatchSize, thresholds, *rolloutTimeout, eventService)
+	return rollout.RunStages(stages)
+}
+
+// runBenchmark runs the rig with each OC profile, reporting the most efficient stable profile of each GPU.
+func runBenchmark() error {
+	profiles, err := mining_monitor.ParseOCProfiles(*benchmarkProfiles)
+	if err != nil {
+		return err
+	}
+	c := newClient()
+	gs, err := newGpuService()
+	if err != nil {
+		return err
+	}
+	benchmark := mining_monitor.NewBenchmark(c, gs, profiles, *benchmarkDuration, *benchmarkWarmup, *statsInterval)
+	// an interrupted benchmark restores the initial GPU settings before exiting
+	s := make(chan os.Signal, 1)
+	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(s)
+	go func() {
+		<-s
+		log.Printf("Stopping benchmark and restoring GPU settings...")
+		benchmark.Stop()
+	}()
+	results, err := benchmark.Run()
+	if err != nil {
+		if len(results) > 0 {
+			log.Printf("Benchmark results before it stopped\n%s", mining_monitor.FormatBenchmarkReport(results))
+		}
+		return err
+	}
+	report := mining_monitor.FormatBenchmarkReport(results)
+	log.Printf("Benchmark finished\n%s", report)
+	eventService := newEventService()
+	go eventService.Start()
+	eventService.E <- mining_monitor.NewEmailEvent(c, "Benchmark results", report)
+	eventService.Stop()
+	return nil
+}
+
+// newRolloutClient creates a client of the -miner type for a rig being rolled out to.
+func newRolloutClient(addr string) (mining_monitor.Client, error) {
+	var c mining_monitor.Client
+	switch *miner {
+	case "claymore":
+		c = mining_monitor.NewClaymoreClient(addr, *claymorePassword, *claymoreVersion)
+	case "antminer":
+		c = mining_monitor.NewAntminerClient(addr, *antminerUser, *antminerPassword)
+	default:
+		return nil, fmt.Errorf("rollouts are not supported for %s miners", *miner)
+	}
+	c.SetReadOnly(*debug, true)
+	return c, nil
+}
+
+// newRolloutThresholds returns the thresholds rigs of the -miner type must pass before and after a rollout.
+func newRolloutThresholds() ([]*mining_monitor.Threshold, error) {
+	if *miner == "antminer" {
+		return boardThresholds(), nil
+	}
+	// rollout clients don't read the GPU models, so an expected hashrate would check nothing
+	if mining_monitor.IsExpectedThreshold(*hashThreshold) {
+		return nil, fmt.Errorf("-hash-threshold %s can't be relative to the expected hashrate for rollouts", *hashThreshold)
+	}
+	hashThreshold, err := newHashRateThreshold()
+	if err != nil {
+		return nil, err
+	}
+	return []*mining_monitor.Threshold{hashThreshold}, nil
+}
+
+// miningAlgorithms returns the algorithms mined, main first.
+func miningAlgorithms() []string {
+	if *algorithm != "" {
+		algorithms := strings.Split(*algorithm, ",")
+		for i, a := range algorithms {
+			algorithms[i] = strings.TrimSpace(a)
+		}
+		return algorithms
+	}
+	if *miner == "antminer" {
+		return []string{"sha256"}
+	}
+	return []string{"ethash"}
+}
+
+func miningAlgorithm() string {
+	return miningAlgorithms()[0]
+}
+
+func newHashRateDatabase() (mining_monitor.HashRateDatabase, error) {
+	db := mining_monitor.NewHashRateDatabase()
+	if *hashRateOverrides != "" {
+		if err := db.LoadOverrides(*hashRateOverrides); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// newHashRateThreshold creates the -hash-threshold, relative to the expected hashrate of each GPU if it refers to
+// expected.
+func newHashRateThreshold() (*mining_monitor.Threshold, error) {
+	if !mining_monitor.IsExpectedThreshold(*hashThreshold) {
+		return mining_monitor.NewHashRateThreshold(*hashThreshold, true, false)
+	}
+	db, err := newHashRateDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return mining_monitor.NewExpectedHashRateThreshold(*hashThreshold, db, miningAlgorithm(), true, false)
+}
+
+func newBoardHashRateThreshold(threshold string, causeReboot, sendEmail bool) (*mining_monitor.Threshold, error) {
+	if !mining_monitor.IsExpectedThreshold(threshold) {
+		return mining_monitor.NewBoardHashRateThreshold(threshold, causeReboot, sendEmail)
+	}
+	db, err := newHashRateDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return mining_monitor.NewExpectedBoardHashRateThreshold(threshold, db, miningAlgorithm(), causeReboot, sendEmail)
+}
+
+// thresholdFlag is a threshold set from the command line, which is skipped if left empty.
+type thresholdFlag struct {
+	threshold   string
+	create      func(threshold string, causeReboot, sendEmail bool) (*mining_monitor.Threshold, error)
+	causeReboot bool
+}
+
+// newThresholds creates the thresholds which were set, all of which send emails.
+func newThresholds(flags ...thresholdFlag) []*mining_monitor.Threshold {
+	var thresholds []*mining_monitor.Threshold
+	for _, f := range flags {
+		if f.threshold == "" {
+			continue
+		}
+		t, err := f.create(f.threshold, f.causeReboot, true)
+		if err != nil {
+			panic(err)
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds
+}
+
+// algorithmThresholds creates a threshold for each algorithm=threshold pair of a comma separated flag, all of which
+// send emails.
+func algorithmThresholds(spec string, create func(algorithm, threshold string, causeReboot, sendEmail bool) (*mining_monitor.Threshold, error), causeReboot bool) []*mining_monitor.Threshold {
+	var thresholds []*mining_monitor.Threshold
+	if spec == "" {
+		return thresholds
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			panic(fmt.Errorf("invalid algorithm threshold %s, must be algorithm=threshold", pair))
+		}
+		t, err := create(parts[0], parts[1], causeReboot, true)
+		if err != nil {
+			panic(err)
 		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds
+}
+
+func minerAddress() string {
+	if *miner == "antminer" {
+		return *antminerAddress
+	}
+	return *claymoreAddress
+}
+
+func newShellService() (mining_monitor.ShellService, error) {
+	addr := *sshAddress
+	if addr == "" {
+		host, _, err := net.SplitHostPort(minerAddress())
+		if err != nil {
+			return nil, fmt.Errorf("unable to derive ssh address from %s: %s", minerAddress(), err)
+		}
+		addr = net.JoinHostPort(host, "22")
+	}
+	return mining_monitor.NewSSHShellService(addr, *sshUser, *sshPassword, *sshKey)
+}
+
+func newGpuService() (mining_monitor.GpuService, error) {
+	sh, err := newShellService()
+	if err != nil {
+		return nil, err
+	}
+	switch *gpuVendor {
+	case "nvidia":
+		return mining_monitor.NewNvidiaGpuService(sh), nil
+	case "amd":
+		return mining_monitor.NewAMDGpuService(sh), nil
+	case "intel":
+		return mining_monitor.NewIntelGpuService(sh), nil
+	default:
+		return nil, fmt.Errorf("unknown gpu vendor %s, must be one of nvidia|amd|intel", *gpuVendor)
 	}
 }
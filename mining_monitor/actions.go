@@ -0,0 +1,188 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ActionFunc is run against every successful stats poll and returns a description of each change it made.
+type ActionFunc func(c Client, stats *Statistics) ([]string, error)
+
+// Action is a soft remediation applied while the client is RUNNING, before thresholds escalate to a reboot.
+type Action struct {
+	Run ActionFunc
+	// Restore optionally undoes the changes still in effect when monitoring of the client stops, returning a
+	// description of each change it made.
+	Restore func(c Client) ([]string, error)
+	Name    string
+}
+
+func (a Action) String() string {
+	return a.Name
+}
+
+type fanCurvePoint struct {
+	temp    float64
+	percent float64
+}
+
+func parseFanCurve(curve string) ([]fanCurvePoint, error) {
+	var points []fanCurvePoint
+	for _, p := range strings.Split(curve, ",") {
+		parts := strings.Split(strings.TrimSpace(p), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid fan curve point %s, expected temperature:percent", p)
+		}
+		temp, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fan curve temperature %s: %s", parts[0], err)
+		}
+		percent, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fan curve percent %s: %s", parts[1], err)
+		}
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid fan curve percent %s, must be between 0 and 100", parts[1])
+		}
+		points = append(points, fanCurvePoint{temp: temp, percent: percent})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].temp < points[j].temp })
+	return points, nil
+}
+
+// fanPercent linearly interpolates the fan percent for temp between the points of the curve.
+func fanPercent(curve []fanCurvePoint, temp float64) float64 {
+	for i := 1; i < len(curve); i++ {
+		if temp < curve[i].temp {
+			lo, hi := curve[i-1], curve[i]
+			return lo.percent + (hi.percent-lo.percent)*(temp-lo.temp)/(hi.temp-lo.temp)
+		}
+	}
+	return curve[len(curve)-1].percent
+}
+
+// NewFanCurveAction takes a curve of the form "65:70,75:90,80:100" (temperature:fan percent). Once a GPU reaches
+// the lowest temperature of the curve its fan is driven along the curve, and once it cools below it again fan
+// control is handed back to the driver.
+func NewFanCurveAction(curve string, gs GpuService) (*Action, error) {
+	points, err := parseFanCurve(curve)
+	if err != nil {
+		return nil, err
+	}
+	controlled := map[int]float64{}
+	return &Action{
+		Run: func(c Client, stats *Statistics) ([]string, error) {
+			var changes []string
+			for i, temp := range stats.GpuTemperatures {
+				current, ok := controlled[i]
+				if temp < points[0].temp {
+					if !ok {
+						continue
+					}
+					if !c.ReadOnly() {
+						if err := gs.ResetFan(i); err != nil {
+							return changes, fmt.Errorf("failed to reset GPU %d fan: %s", i, err)
+						}
+					}
+					delete(controlled, i)
+					changes = append(changes, fmt.Sprintf("GPU %d cooled to %0.2f, fan control returned to driver", i, temp))
+					continue
+				}
+				percent := fanPercent(points, temp)
+				if ok && int(current) == int(percent) {
+					continue
+				}
+				// only fans which were actually set are tracked, read only runs report the change on every poll
+				if !c.ReadOnly() {
+					if err := gs.SetFanPercent(i, percent); err != nil {
+						return changes, fmt.Errorf("failed to set GPU %d fan: %s", i, err)
+					}
+					controlled[i] = percent
+				}
+				changes = append(changes, fmt.Sprintf("GPU %d temperature %0.2f, fan set to %0.0f%%", i, temp, percent))
+			}
+			return changes, nil
+		},
+		Name: fmt.Sprintf("FanCurve: %s", curve),
+	}, nil
+}
+
+// powerLimitRecoveryMargin is how far below the soft limit a GPU must cool before its power limit is raised again.
+const powerLimitRecoveryMargin = 5.0
+
+// NewPowerLimitAction lowers the power limit of a GPU by step watts on every poll its core or memory temperature
+// exceeds softLimit, never going below min. Once the GPU has cooled below the soft limit its power limit is raised
+// again by step watts per poll until the original limit is restored. Limits still lowered when monitoring stops are
+// restored, so they do not outlive the monitor. Read only clients are only reported once per GPU each time it
+// overheats. Requires the GpuService to also be configured as a Collector so the current power limits are known.
+func NewPowerLimitAction(softLimit, step, min float64, gs GpuService) (*Action, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("power limit step must be greater than 0, got %0.2f", step)
+	}
+	original := map[int]float64{}
+	reported := map[int]bool{}
+	return &Action{
+		Run: func(c Client, stats *Statistics) ([]string, error) {
+			var changes []string
+			for i, temp := range stats.GpuTemperatures {
+				if i < len(stats.GpuMemoryTemperatures) && stats.GpuMemoryTemperatures[i] > temp {
+					temp = stats.GpuMemoryTemperatures[i]
+				}
+				if i >= len(stats.GpuPowerLimits) || stats.GpuPowerLimits[i] == 0 {
+					if temp > softLimit {
+						return changes, fmt.Errorf("GPU %d power limit unknown, unable to lower it", i)
+					}
+					continue
+				}
+				limit := stats.GpuPowerLimits[i]
+				if c.ReadOnly() {
+					if temp > softLimit && !reported[i] {
+						reported[i] = true
+						changes = append(changes, fmt.Sprintf("GPU %d temperature %0.2f, read only, power limit left at %0.0fW", i, temp, limit))
+					} else if temp < softLimit-powerLimitRecoveryMargin {
+						delete(reported, i)
+					}
+					continue
+				}
+				restore, lowered := original[i]
+				var target float64
+				switch {
+				case temp > softLimit:
+					target = math.Max(limit-step, math.Min(min, limit))
+				case lowered && temp < softLimit-powerLimitRecoveryMargin:
+					target = math.Min(limit+step, restore)
+				default:
+					continue
+				}
+				if target == limit {
+					continue
+				}
+				if err := gs.SetPowerLimit(i, target); err != nil {
+					return changes, fmt.Errorf("failed to set GPU %d power limit: %s", i, err)
+				}
+				if !lowered {
+					original[i] = limit
+				} else if target == restore {
+					delete(original, i)
+				}
+				changes = append(changes, fmt.Sprintf("GPU %d temperature %0.2f, power limit changed %0.0fW -> %0.0fW", i, temp, limit, target))
+			}
+			return changes, nil
+		},
+		Restore: func(c Client) ([]string, error) {
+			var changes []string
+			for i, limit := range original {
+				if err := gs.SetPowerLimit(i, limit); err != nil {
+					return changes, fmt.Errorf("failed to restore GPU %d power limit: %s", i, err)
+				}
+				delete(original, i)
+				changes = append(changes, fmt.Sprintf("GPU %d power limit restored to %0.0fW", i, limit))
+			}
+			return changes, nil
+		},
+		Name: fmt.Sprintf("PowerLimit: >%0.0f", softLimit),
+	}, nil
+}
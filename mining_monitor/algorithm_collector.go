@@ -0,0 +1,23 @@
+package mining_monitor
+
+// AlgorithmCollector names the algorithms of miners which do not report what they are mining, in the order they
+// are mined. Stats recorded before algorithms were reported get algorithms from their Main and Alt fields.
+type AlgorithmCollector struct {
+	names []string
+}
+
+func NewAlgorithmCollector(names []string) Collector {
+	return &AlgorithmCollector{names: names}
+}
+
+func (a *AlgorithmCollector) Collect(stats *Statistics) error {
+	if len(stats.Algorithms) == 0 {
+		stats.setMainAltAlgorithms()
+	}
+	for i := range stats.Algorithms {
+		if stats.Algorithms[i].Algorithm == "" && i < len(a.names) {
+			stats.Algorithms[i].Algorithm = a.names[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// benchmarkMaxVariation is the highest coefficient of variation of a GPU hashrate during a profile for the profile to
+// be considered stable
+const benchmarkMaxVariation = 0.1
+
+// OCProfile is a set of GPU settings benchmarked together. A PowerLimit of 0 keeps the current power limit.
+type OCProfile struct {
+	Name         string
+	PowerLimit   float64
+	CoreOffset   float64
+	MemoryOffset float64
+}
+
+func (p OCProfile) String() string {
+	return fmt.Sprintf("%s (%0.0fW, core %+0.0fMHz, memory %+0.0fMHz)", p.Name, p.PowerLimit, p.CoreOffset, p.MemoryOffset)
+}
+
+// ParseOCProfiles parses comma separated profiles of the form name=powerLimit[/coreOffset/memoryOffset] e.g.
+// eco=120,fast=160/100/800.
+func ParseOCProfiles(s string) ([]OCProfile, error) {
+	var profiles []OCProfile
+	for _, spec := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(spec), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid profile %s, expected name=powerLimit[/coreOffset/memoryOffset]", spec)
+		}
+		values := strings.Split(parts[1], "/")
+		if len(values) != 1 && len(values) != 3 {
+			return nil, fmt.Errorf("invalid profile %s, expected name=powerLimit[/coreOffset/memoryOffset]", spec)
+		}
+		profile := OCProfile{Name: parts[0]}
+		for i, dst := range []*float64{&profile.PowerLimit, &profile.CoreOffset, &profile.MemoryOffset}[:len(values)] {
+			var err error
+			if *dst, err = strconv.ParseFloat(values[i], 64); err != nil {
+				return nil, fmt.Errorf("invalid profile %s: %s", spec, err)
+			}
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+type BenchmarkResult struct {
+	Profile  OCProfile
+	Gpu      int
+	HashRate float64
+	Power    float64
+	Stable   bool
+	Reason   string
+}
+
+// Efficiency is the hashrate per Watt, 0 if the power draw is unknown.
+func (r BenchmarkResult) Efficiency() float64 {
+	if r.Power == 0 {
+		return 0
+	}
+	return r.HashRate / r.Power
+}
+
+func (r BenchmarkResult) String() string {
+	s := fmt.Sprintf("GPU %d %s: hashrate %0.0f at %0.0fW, %0.2f per W", r.Gpu, r.Profile, r.HashRate, r.Power, r.Efficiency())
+	if !r.Stable {
+		s += fmt.Sprintf(", UNSTABLE: %s", r.Reason)
+	}
+	return s
+}
+
+// Benchmark runs a rig with each OCProfile in turn, sampling the hashrate and power draw of every GPU.
+type Benchmark struct {
+	c        Client
+	gs       GpuService
+	profiles []OCProfile
+	duration time.Duration
+	warmup   time.Duration
+	interval time.Duration
+
+	offsetsSet bool
+	// offsets are the core and memory clock offsets of each GPU before the benchmark
+	offsets  [][2]float64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewBenchmark returns a Benchmark which runs each profile for warmup plus duration, sampling stats every interval
+// after the warmup.
+func NewBenchmark(c Client, gs GpuService, profiles []OCProfile, duration, warmup, interval time.Duration) *Benchmark {
+	return &Benchmark{c: c, gs: gs, profiles: profiles, duration: duration, warmup: warmup, interval: interval,
+		stop: make(chan struct{})}
+}
+
+// Stop interrupts a running benchmark, which restores the initial GPU settings before Run returns.
+func (b *Benchmark) Stop() {
+	b.stopOnce.Do(func() { close(b.stop) })
+}
+
+// sleep waits for d, returning false if the benchmark was stopped in the meantime.
+func (b *Benchmark) sleep(d time.Duration) bool {
+	select {
+	case <-b.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (b *Benchmark) stopped() bool {
+	select {
+	case <-b.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *Benchmark) stats() (*Statistics, error) {
+	stats, err := b.c.Stats()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.gs.Collect(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Run benchmarks every profile, restoring the initial power limits and clocks afterwards or once stopped. As the
+// benchmark changes GPU settings it does not run on read only clients.
+func (b *Benchmark) Run() ([]BenchmarkResult, error) {
+	if b.c.ReadOnly() {
+		return nil, fmt.Errorf("benchmark changes GPU settings and %s is read only", b.c.IP())
+	}
+	initial, err := b.stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initial stats: %s", err)
+	}
+	gpus := len(initial.MainGpuHashRate)
+	if gpus == 0 {
+		return nil, fmt.Errorf("no GPUs reported by %s", b.c.IP())
+	}
+	b.offsets = make([][2]float64, gpus)
+	for gpu := range b.offsets {
+		// GPUs without clock offset support are restored to their default clocks
+		if core, memory, err := b.gs.ClockOffsets(gpu); err == nil {
+			b.offsets[gpu] = [2]float64{core, memory}
+		}
+	}
+	defer b.restore(initial, gpus)
+	var results []BenchmarkResult
+	for _, p := range b.profiles {
+		glog.Infof("[%s] benchmarking profile %s", b.c.IP(), p)
+		results = append(results, b.runProfile(p, gpus)...)
+		if b.stopped() {
+			return results, fmt.Errorf("benchmark of %s interrupted", b.c.IP())
+		}
+	}
+	return results, nil
+}
+
+func (b *Benchmark) apply(p OCProfile, gpus int) error {
+	for gpu := 0; gpu < gpus; gpu++ {
+		if p.PowerLimit > 0 {
+			if err := b.gs.SetPowerLimit(gpu, p.PowerLimit); err != nil {
+				return err
+			}
+		}
+		if p.CoreOffset != 0 || p.MemoryOffset != 0 || b.offsetsSet {
+			if err := b.gs.SetClockOffsets(gpu, p.CoreOffset, p.MemoryOffset); err != nil {
+				return err
+			}
+			b.offsetsSet = true
+		}
+	}
+	return nil
+}
+
+func (b *Benchmark) restore(initial *Statistics, gpus int) {
+	for gpu := 0; gpu < gpus; gpu++ {
+		if limit := floatAt(initial.GpuPowerLimits, gpu); limit > 0 {
+			if err := b.gs.SetPowerLimit(gpu, limit); err != nil {
+				glog.Infof("[%s] failed to restore GPU %d power limit: %s", b.c.IP(), gpu, err)
+			}
+		}
+		if b.offsetsSet {
+			if err := b.gs.SetClockOffsets(gpu, b.offsets[gpu][0], b.offsets[gpu][1]); err != nil {
+				glog.Infof("[%s] failed to restore GPU %d clocks: %s", b.c.IP(), gpu, err)
+			}
+		}
+	}
+}
+
+func (b *Benchmark) runProfile(p OCProfile, gpus int) []BenchmarkResult {
+	results := make([]BenchmarkResult, gpus)
+	for gpu := range results {
+		results[gpu] = BenchmarkResult{Profile: p, Gpu: gpu, Stable: true}
+	}
+	fail := func(reason string) []BenchmarkResult {
+		for gpu := range results {
+			results[gpu].Stable = false
+			results[gpu].Reason = reason
+		}
+		return results
+	}
+	if err := b.apply(p, gpus); err != nil {
+		return fail(fmt.Sprintf("failed to apply profile: %s", err))
+	}
+	if !b.sleep(b.warmup) {
+		return fail("interrupted")
+	}
+
+	var first *Statistics
+	hashRates := make([][]float64, gpus)
+	powers := make([]float64, gpus)
+	for end := time.Now().Add(b.duration); time.Now().Before(end); {
+		if first != nil && !b.sleep(b.interval) {
+			return fail("interrupted")
+		}
+		stats, err := b.stats()
+		if err != nil {
+			// give the next profile a running miner
+			if err := b.c.Restart(); err != nil {
+				glog.Infof("[%s] failed to restart miner: %s", b.c.IP(), err)
+			}
+			b.sleep(b.warmup)
+			return fail(fmt.Sprintf("miner stopped responding: %s", err))
+		}
+		if first == nil {
+			first = stats
+		}
+		if stats.RunningTime < first.RunningTime {
+			return fail("miner restarted")
+		}
+		for gpu := 0; gpu < gpus; gpu++ {
+			hashRates[gpu] = append(hashRates[gpu], floatAt(stats.MainGpuHashRate, gpu))
+			powers[gpu] += floatAt(stats.GpuPowers, gpu)
+			if gpu < len(stats.MainGpuInvalidShares) && gpu < len(first.MainGpuInvalidShares) &&
+				stats.MainGpuInvalidShares[gpu] > first.MainGpuInvalidShares[gpu] && results[gpu].Stable {
+				results[gpu].Stable = false
+				results[gpu].Reason = fmt.Sprintf("%d invalid shares", stats.MainGpuInvalidShares[gpu]-first.MainGpuInvalidShares[gpu])
+			}
+		}
+	}
+	for gpu := range results {
+		samples := hashRates[gpu]
+		if len(samples) == 0 {
+			return fail("no stats sampled")
+		}
+		mean, min := 0.0, math.Inf(1)
+		for _, h := range samples {
+			mean += h / float64(len(samples))
+			min = math.Min(min, h)
+		}
+		variance := 0.0
+		for _, h := range samples {
+			variance += (h - mean) * (h - mean) / float64(len(samples))
+		}
+		results[gpu].HashRate = mean
+		results[gpu].Power = powers[gpu] / float64(len(samples))
+		if !results[gpu].Stable {
+			continue
+		}
+		if min == 0 {
+			results[gpu].Stable, results[gpu].Reason = false, "stopped hashing"
+		} else if cv := math.Sqrt(variance) / mean; cv > benchmarkMaxVariation {
+			results[gpu].Stable, results[gpu].Reason = false, fmt.Sprintf("hashrate varied by %0.0f%%", cv*100)
+		}
+	}
+	return results
+}
+
+// BestProfiles returns the most efficient stable result of each GPU, or the highest hashrate if the power draw is
+// unknown. GPUs without a stable profile are left out.
+func BestProfiles(results []BenchmarkResult) []BenchmarkResult {
+	best := map[int]BenchmarkResult{}
+	var order []int
+	for _, r := range results {
+		if !r.Stable {
+			continue
+		}
+		current, ok := best[r.Gpu]
+		if !ok {
+			order = append(order, r.Gpu)
+		}
+		if !ok || r.Efficiency() > current.Efficiency() ||
+			(r.Efficiency() == current.Efficiency() && r.HashRate > current.HashRate) {
+			best[r.Gpu] = r
+		}
+	}
+	var res []BenchmarkResult
+	for _, gpu := range order {
+		res = append(res, best[gpu])
+	}
+	return res
+}
+
+// FormatBenchmarkReport lists every result followed by the best profile of each GPU.
+func FormatBenchmarkReport(results []BenchmarkResult) string {
+	report := "Results:\n"
+	for _, r := range results {
+		report += r.String() + "\n"
+	}
+	report += "\nBest stable profile per GPU:\n"
+	for _, r := range BestProfiles(results) {
+		report += r.String() + "\n"
+	}
+	return report
+}
@@ -1,5 +1,7 @@
 package mining_monitor
 
+import "strings"
+
 type Client interface {
 	IP() string
 	Stats() (*Statistics, error)
@@ -15,9 +17,26 @@ type Client interface {
 
 type Statistics struct {
 	Version         string
+	Model           string
 	RunningTime     int
 	GpuTemperatures []float64
 	GpuFanPercents  []float64
+	// GpuModels are the product names of the GPUs, as reported by the GpuService
+	GpuModels []string
+
+	GpuMemoryTemperatures []float64
+	GpuPowers             []float64
+	GpuPowerLimits        []float64
+	GpuMemoryErrors       []float64
+	GpuRetiredPages       []float64
+	GpuPcieLinkWidths     []float64
+	GpuPcieLinkGens       []float64
+	// GpuPcieLinkMaxWidths and GpuPcieLinkMaxGens are the best link the GPU and the slot it is in both support,
+	// regardless of any riser between them
+	GpuPcieLinkMaxWidths []float64
+	GpuPcieLinkMaxGens   []float64
+
+	KernelErrors []string
 
 	MainMiningPool        string
 	MainHashRate          float64
@@ -41,5 +60,118 @@ type Statistics struct {
 	AltPoolSwitches      int
 	AltInvalidShares     int
 
+	// Algorithms are the algorithms mined concurrently, the first being the main algorithm and the second the alt
+	// algorithm of dual miners. The Main and Alt fields are kept for compatibility.
+	Algorithms []AlgorithmStats
+
+	// Pools are the pools configured on the miner, rather than the ones it is mining to
+	Pools []PoolConfig
+	// PoolsError is why the pools could not be read when they never have been, so checks of the pools fail closed
+	PoolsError string
+
+	// Boards holds the hashboards of ASIC miners, hashrates are in the same unit as MainHashRate
+	Boards []BoardStats
+	// BoardCount is the number of hashboards the miner is built with, including dead boards it no longer reports,
+	// or 0 if unknown
+	BoardCount int
+
 	PowerState *PowerState
+	Revenue    *RevenueStats
+	Host       *HostStats
+	Disk       *DiskHealth
+}
+
+// AlgorithmStats are the statistics of one algorithm, hashrates are in the unit the miner reports them in.
+type AlgorithmStats struct {
+	Algorithm         string
+	Pool              string
+	HashRate          float64
+	Shares            int
+	RejectedShares    int
+	InvalidShares     int
+	PoolSwitches      int
+	GpuHashRate       []float64
+	GpuShares         []int
+	GpuRejectedShares []int
+	GpuInvalidShares  []int
+
+	// Coin is the coin mined and its price, set by the RevenueCollector
+	Coin          string
+	CoinsPerDay   float64
+	Price         float64
+	RevenuePerDay float64
+}
+
+// Algorithm returns the statistics of the named algorithm, or nil if it is not being mined.
+func (s *Statistics) Algorithm(name string) *AlgorithmStats {
+	for i := range s.Algorithms {
+		if strings.EqualFold(s.Algorithms[i].Algorithm, name) {
+			return &s.Algorithms[i]
+		}
+	}
+	return nil
+}
+
+// SetAlgorithms sets the algorithms mined, filling the Main and Alt fields from the first two.
+func (s *Statistics) SetAlgorithms(algorithms []AlgorithmStats) {
+	s.Algorithms = algorithms
+	if len(algorithms) > 0 {
+		a := algorithms[0]
+		s.MainMiningPool, s.MainHashRate, s.MainShares, s.MainRejectedShares = a.Pool, a.HashRate, a.Shares, a.RejectedShares
+		s.MainInvalidShares, s.MainPoolSwitches, s.MainGpuHashRate = a.InvalidShares, a.PoolSwitches, a.GpuHashRate
+		s.MainGpuShares, s.MainGpuRejectedShares, s.MainGpuInvalidShares = a.GpuShares, a.GpuRejectedShares, a.GpuInvalidShares
+	}
+	if len(algorithms) > 1 {
+		a := algorithms[1]
+		s.AltMiningPool, s.AltHashRate, s.AltShares, s.AltRejectedShares = a.Pool, a.HashRate, a.Shares, a.RejectedShares
+		s.AltInvalidShares, s.AltPoolSwitches, s.AltGpuHashRate = a.InvalidShares, a.PoolSwitches, a.GpuHashRate
+		s.AltGpuShares, s.AltGpuRejectedShares, s.AltGpuInvalidShares = a.GpuShares, a.GpuRejectedShares, a.GpuInvalidShares
+	}
+}
+
+// setMainAltAlgorithms sets the algorithms of miners which report at most a main and an alt algorithm from the Main
+// and Alt fields. The alt algorithm is only added when dual mining. Algorithm names are left to be filled in by the
+// AlgorithmCollector, as miners do not report them.
+func (s *Statistics) setMainAltAlgorithms() {
+	s.Algorithms = []AlgorithmStats{{
+		Pool:              s.MainMiningPool,
+		HashRate:          s.MainHashRate,
+		Shares:            s.MainShares,
+		RejectedShares:    s.MainRejectedShares,
+		InvalidShares:     s.MainInvalidShares,
+		PoolSwitches:      s.MainPoolSwitches,
+		GpuHashRate:       s.MainGpuHashRate,
+		GpuShares:         s.MainGpuShares,
+		GpuRejectedShares: s.MainGpuRejectedShares,
+		GpuInvalidShares:  s.MainGpuInvalidShares,
+	}}
+	if s.AltMiningPool == "" && s.AltHashRate == 0 {
+		return
+	}
+	s.Algorithms = append(s.Algorithms, AlgorithmStats{
+		Pool:              s.AltMiningPool,
+		HashRate:          s.AltHashRate,
+		Shares:            s.AltShares,
+		RejectedShares:    s.AltRejectedShares,
+		InvalidShares:     s.AltInvalidShares,
+		PoolSwitches:      s.AltPoolSwitches,
+		GpuHashRate:       s.AltGpuHashRate,
+		GpuShares:         s.AltGpuShares,
+		GpuRejectedShares: s.AltGpuRejectedShares,
+		GpuInvalidShares:  s.AltGpuInvalidShares,
+	})
+}
+
+type PoolConfig struct {
+	URL    string
+	Wallet string
+}
+
+type BoardStats struct {
+	Chain           int
+	HashRate        float64
+	Temperature     float64
+	ChipTemperature float64
+	Chips           float64
+	HardwareErrors  float64
 }
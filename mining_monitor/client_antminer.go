@@ -0,0 +1,320 @@
+package mining_monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	antminerRebootPath = "/cgi-bin/reboot.cgi"
+
+	// chain statistics are reported as <prefix><chain>, e.g. chain_rate6 for the hashrate of chain 6
+	antminerChainRate     = "chain_rate"
+	antminerChainChips    = "chain_acn"
+	antminerChainHwErrors = "chain_hw"
+)
+
+// AntminerClient monitors Bitmain Antminer ASICs through the cgminer API, and reboots them through the web
+// interface.
+type AntminerClient struct {
+	addr         string
+	webUser      string
+	webPassword  string
+	readOnly     bool
+	failOnWrites bool
+
+	ps   PowerService
+	http *http.Client
+}
+
+func NewAntminerClient(addr, webUser, webPassword string) Client {
+	return &AntminerClient{addr: addr, webUser: webUser, webPassword: webPassword, http: &http.Client{Timeout: httpTimeout}}
+}
+
+func NewAntminerClientWithPowerService(addr, webUser, webPassword string, ps PowerService) Client {
+	return &AntminerClient{addr: addr, webUser: webUser, webPassword: webPassword, ps: ps, http: &http.Client{Timeout: httpTimeout}}
+}
+
+func (c *AntminerClient) SetReadOnly(readOnly, failOnWrites bool) {
+	c.readOnly = readOnly
+	c.failOnWrites = failOnWrites
+}
+
+type cgminerStatus struct {
+	Status string `json:"STATUS"`
+	Msg    string `json:"Msg"`
+}
+
+type cgminerResponse struct {
+	Status  []cgminerStatus          `json:"STATUS"`
+	Summary []map[string]interface{} `json:"SUMMARY"`
+	Stats   []map[string]interface{} `json:"STATS"`
+	Pools   []map[string]interface{} `json:"POOLS"`
+	Devs    []map[string]interface{} `json:"DEVS"`
+}
+
+// cgminerCommand sends a command to the cgminer API at addr.
+func cgminerCommand(addr, command string) (*cgminerResponse, error) {
+	conn, err := net.DialTimeout("tcp", addr, httpTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote addr %s: %s", addr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(httpTimeout))
+	if _, err := fmt.Fprintf(conn, `{"command":"%s"}`, command); err != nil {
+		return nil, fmt.Errorf("failed to write to remote addr %s: %s", addr, err)
+	}
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote addr %s reply: %s", addr, err)
+	}
+	// replies are null terminated, and the stats of some firmwares are missing the separator between objects
+	reply = bytes.TrimRight(reply, "\x00")
+	reply = bytes.Replace(reply, []byte("}{"), []byte("},{"), -1)
+	var response cgminerResponse
+	if err := json.Unmarshal(reply, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response from remote addr %s got %s: %s", addr, string(reply), err)
+	}
+	if len(response.Status) > 0 && response.Status[0].Status == "E" {
+		return nil, fmt.Errorf("%s command failed on %s: %s", command, addr, response.Status[0].Msg)
+	}
+	return &response, nil
+}
+
+// cgminerActivePool returns the URL of the first alive pool of the cgminer API at addr.
+func cgminerActivePool(addr string) (string, error) {
+	pools, err := cgminerCommand(addr, "pools")
+	if err != nil {
+		return "", err
+	}
+	for _, pool := range pools.Pools {
+		if status, _ := pool["Status"].(string); status == "Alive" {
+			url, _ := pool["URL"].(string)
+			return url, nil
+		}
+	}
+	return "", nil
+}
+
+func (c *AntminerClient) send(command string) (*cgminerResponse, error) {
+	return cgminerCommand(c.addr, command)
+}
+
+// cgminerFloat reads a number from a cgminer reply, which depending on the firmware may be sent as a string.
+// Strings of dash separated numbers, as used for per sensor temperatures, return the highest of them.
+func cgminerFloat(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case string:
+		max, found := 0.0, false
+		for _, s := range strings.Split(value, "-") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				continue
+			}
+			if !found || f > max {
+				max, found = f, true
+			}
+		}
+		return max, found
+	}
+	return 0, false
+}
+
+// antminerBoards builds the statistics of every chain reported in the cgminer stats. Board temperatures are reported
+// as temp<chain> or temp_pcb<chain>, and chip temperatures as temp2_<chain> or temp_chip<chain> depending on the
+// model.
+//
+// Some firmwares report every slot of the control board whether a board is plugged into it or not, so a chain
+// reading no chips and no hashrate is either an empty slot or a dead board. Slots without a chip count are never
+// wired, and of the remaining zero chains as many as miner_count says are missing are reported as dead boards with
+// no chips, preferring chains which report a hashrate of 0 over those which report none at all.
+func antminerBoards(stats map[string]interface{}) []BoardStats {
+	var boards, zero []BoardStats
+	hasRate := map[int]bool{}
+	for key, value := range stats {
+		if !strings.HasPrefix(key, antminerChainRate) {
+			continue
+		}
+		chain, err := strconv.Atoi(strings.TrimPrefix(key, antminerChainRate))
+		if err != nil {
+			continue
+		}
+		board := BoardStats{Chain: chain}
+		var chipsOk bool
+		board.HashRate, hasRate[chain] = cgminerFloat(value)
+		if board.Chips, chipsOk = cgminerFloat(stats[fmt.Sprintf("%s%d", antminerChainChips, chain)]); !chipsOk {
+			continue
+		}
+		board.HardwareErrors, _ = cgminerFloat(stats[fmt.Sprintf("%s%d", antminerChainHwErrors, chain)])
+		for _, k := range []string{"temp%d", "temp_pcb%d"} {
+			if t, ok := cgminerFloat(stats[fmt.Sprintf(k, chain)]); ok {
+				board.Temperature = math.Max(board.Temperature, t)
+			}
+		}
+		for _, k := range []string{"temp2_%d", "temp_chip%d"} {
+			if t, ok := cgminerFloat(stats[fmt.Sprintf(k, chain)]); ok {
+				board.ChipTemperature = math.Max(board.ChipTemperature, t)
+			}
+		}
+		if board.Chips == 0 && board.HashRate == 0 {
+			zero = append(zero, board)
+			continue
+		}
+		boards = append(boards, board)
+	}
+	sort.Slice(zero, func(i, j int) bool {
+		if hasRate[zero[i].Chain] != hasRate[zero[j].Chain] {
+			return hasRate[zero[i].Chain]
+		}
+		return zero[i].Chain < zero[j].Chain
+	})
+	count, ok := cgminerFloat(stats["miner_count"])
+	for _, board := range zero {
+		if ok && len(boards) >= int(count) {
+			break
+		}
+		boards = append(boards, board)
+	}
+	sort.Slice(boards, func(i, j int) bool { return boards[i].Chain < boards[j].Chain })
+	return boards
+}
+
+func (c *AntminerClient) Stats() (*Statistics, error) {
+	summary, err := c.send("summary")
+	if err != nil {
+		return nil, err
+	}
+	if len(summary.Summary) == 0 {
+		return nil, fmt.Errorf("empty summary from remote addr %s", c.addr)
+	}
+	stats := &Statistics{}
+	elapsed, _ := cgminerFloat(summary.Summary[0]["Elapsed"])
+	stats.RunningTime = int(elapsed / 60)
+	stats.MainHashRate, _ = cgminerFloat(summary.Summary[0]["GHS 5s"])
+	accepted, _ := cgminerFloat(summary.Summary[0]["Accepted"])
+	rejected, _ := cgminerFloat(summary.Summary[0]["Rejected"])
+	stats.MainShares = int(accepted)
+	stats.MainRejectedShares = int(rejected)
+
+	minerStats, err := c.send("stats")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range minerStats.Stats {
+		if v, ok := s["CGMiner"].(string); ok {
+			stats.Version = v
+		}
+		if v, ok := s["Type"].(string); ok {
+			stats.Model = v
+		}
+		if count, ok := cgminerFloat(s["miner_count"]); ok {
+			stats.Boards = antminerBoards(s)
+			stats.BoardCount = int(count)
+		}
+	}
+
+	if stats.MainMiningPool, err = cgminerActivePool(c.addr); err != nil {
+		return nil, err
+	}
+	stats.setMainAltAlgorithms()
+
+	if c.ps != nil {
+		powerStats, err := c.ps.State()
+		if err != nil {
+			return nil, err
+		}
+		stats.PowerState = powerStats
+	}
+	glog.V(3).Infof("[%s] Stats: %+v", c.IP(), stats)
+	return stats, nil
+}
+
+// PoolConfigs returns the configured pools, whose user is the wallet or pool account mined to.
+func (c *AntminerClient) PoolConfigs() ([]PoolConfig, error) {
+	pools, err := c.send("pools")
+	if err != nil {
+		return nil, err
+	}
+	var configs []PoolConfig
+	for _, pool := range pools.Pools {
+		url, _ := pool["URL"].(string)
+		user, _ := pool["User"].(string)
+		configs = append(configs, PoolConfig{URL: url, Wallet: user})
+	}
+	return configs, nil
+}
+
+func (c *AntminerClient) webURL(path string) string {
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		host = c.addr
+	}
+	return fmt.Sprintf("http://%s%s", host, path)
+}
+
+func (c *AntminerClient) Reboot() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	resp, err := digestRequest(c.http, http.MethodGet, c.webURL(antminerRebootPath), "", nil, c.webUser, c.webPassword)
+	if err != nil {
+		return fmt.Errorf("failed to reboot %s: %s", c.addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to reboot %s: %s", c.addr, resp.Status)
+	}
+	return nil
+}
+
+func (c *AntminerClient) Restart() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	_, err := c.send("restart")
+	return err
+}
+
+func (c *AntminerClient) PowerCycleEnabled() bool {
+	return c.ps != nil
+}
+
+func (c *AntminerClient) PowerCycle() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	if c.ps == nil {
+		return fmt.Errorf("power cycle not enabled on this client, no power service available")
+	}
+	return cyclePower(c.ps)
+}
+
+func (c *AntminerClient) ReadOnly() bool {
+	return c.readOnly
+}
+
+func (c *AntminerClient) IP() string {
+	return c.addr
+}
@@ -1,6 +1,7 @@
 package mining_monitor
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -40,10 +41,11 @@ func (c *ClaymoreClient) SetReadOnly(readOnly, failOnWrites bool) {
 }
 
 type claymoreRequest struct {
-	ID       int    `json:"id"`
-	JsonRpc  string `json:"jsonrpc"`
-	Method   string `json:"method"`
-	Password string `json:"psw,omitempty"`
+	ID       int      `json:"id"`
+	JsonRpc  string   `json:"jsonrpc"`
+	Method   string   `json:"method"`
+	Params   []string `json:"params,omitempty"`
+	Password string   `json:"psw,omitempty"`
 }
 
 type claymoreResponse struct {
@@ -52,11 +54,12 @@ type claymoreResponse struct {
 	Error  string   `json:"error"`
 }
 
-func (c *ClaymoreClient) send(method string, expectReply bool) (*claymoreResponse, error) {
+func (c *ClaymoreClient) send(method string, expectReply bool, params ...string) (*claymoreResponse, error) {
 	req := &claymoreRequest{
 		ID:       0,
 		JsonRpc:  "2.0",
 		Method:   method,
+		Params:   params,
 		Password: c.password,
 	}
 	b, err := json.Marshal(req)
@@ -71,19 +74,17 @@ func (c *ClaymoreClient) send(method string, expectReply bool) (*claymoreRespons
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to remote addr %s: %s", c.addr, err)
 	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(httpTimeout))
 	if _, err := conn.Write(b); err != nil {
 		return nil, fmt.Errorf("failed to write to remote addr %s: %s", c.addr, err)
 	}
 
 	if expectReply {
-		reply := make([]byte, 1024)
-		n, err := conn.Read(reply)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read remote addr %s reply: %s", c.addr, err)
-		}
+		// replies such as miner_getfile can be larger than a single read
 		var response claymoreResponse
-		if err := json.Unmarshal(reply[:n], &response); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal response from remote addr %s got %s: %s", c.addr, string(b[:n]), err)
+		if err := json.NewDecoder(conn).Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to read response from remote addr %s: %s", c.addr, err)
 		}
 		return &response, nil
 	}
@@ -215,6 +216,7 @@ func (c *ClaymoreClient) Stats() (*Statistics, error) {
 		return nil, fmt.Errorf("failed to parse gpu alt invalid from %s: %s", resp.Result[14], err)
 	}
 	stats.AltGpuInvalidShares = gpuAltInvalid
+	stats.setMainAltAlgorithms()
 	if c.ps != nil {
 		powerStats, err := c.ps.State()
 		if err != nil {
@@ -262,36 +264,110 @@ func (c *ClaymoreClient) Restart() error {
 	return nil
 }
 
-func (c *ClaymoreClient) PowerCycleEnabled() bool {
-	return c.ps != nil
-}
-
-func (c *ClaymoreClient) PowerCycle() error {
+// WriteFile replaces a file in the miner directory, such as config.txt or epools.txt, after which the miner restarts.
+func (c *ClaymoreClient) WriteFile(name string, data []byte) error {
 	if c.readOnly {
 		if c.failOnWrites {
 			return fmt.Errorf("client is read only")
 		}
 		return nil
 	}
-	if c.ps == nil {
-		return fmt.Errorf("power cycle not enabled on this client, no power service available")
+	if c.password == "" {
+		return fmt.Errorf("remote console does not have a password set and is insecure, " +
+			"please set a password to use this functionality")
 	}
-	state, err := c.ps.State()
+	_, err := c.send("miner_file", false, name, hex.EncodeToString(data))
+	return err
+}
+
+// ReadFile reads a file from the miner directory, such as config.txt or epools.txt.
+func (c *ClaymoreClient) ReadFile(name string) ([]byte, error) {
+	data, found, err := c.readFile(name)
+	if err == nil && !found {
+		return nil, fmt.Errorf("failed to read %s from %s: file not found", name, c.addr)
+	}
+	return data, err
+}
+
+// readFile reads a file from the miner directory, found is false if the miner could not read the file.
+func (c *ClaymoreClient) readFile(name string) ([]byte, bool, error) {
+	resp, err := c.send("miner_getfile", true, name)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
+	if len(resp.Result) < 2 {
+		glog.V(2).Infof("[%s] unable to read %s: %s", c.IP(), name, resp.Error)
+		return nil, false, nil
+	}
+	data, err := hex.DecodeString(resp.Result[1])
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode %s from %s: %s", name, c.addr, err)
+	}
+	return data, true, nil
+}
 
-	if state.On {
-		if err := c.ps.Off(); err != nil {
-			return fmt.Errorf("failed to turn power off: %s", err)
+// PoolConfigs returns the pools configured in epools.txt, followed by the main and dual mining pools of config.txt.
+// epools.txt is optional, and read as empty when the miner has none.
+func (c *ClaymoreClient) PoolConfigs() ([]PoolConfig, error) {
+	var pools []PoolConfig
+	epools, _, err := c.readFile("epools.txt")
+	if err != nil {
+		return nil, err
+	}
+	// POOL: eth-eu1.nanopool.org:9999, WALLET: 0x..., PSW: x, ...
+	for _, line := range strings.Split(string(epools), "\n") {
+		var pool PoolConfig
+		for _, field := range strings.Split(line, ",") {
+			kv := strings.SplitN(field, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.TrimSpace(kv[0]) {
+			case "POOL":
+				pool.URL = strings.TrimSpace(kv[1])
+			case "WALLET":
+				pool.Wallet = strings.TrimSpace(kv[1])
+			}
+		}
+		if pool.URL != "" {
+			pools = append(pools, pool)
+		}
+	}
+	config, err := c.ReadFile("config.txt")
+	if err != nil {
+		return nil, err
+	}
+	// -epool eth-eu1.nanopool.org:9999 -ewal 0x... -dpool ... -dwal ...
+	args := map[string]string{}
+	fields := strings.Fields(string(config))
+	for i := 0; i+1 < len(fields); i++ {
+		if strings.HasPrefix(fields[i], "-") {
+			args[fields[i]] = fields[i+1]
+		}
+	}
+	for _, opts := range [][2]string{{"-epool", "-ewal"}, {"-dpool", "-dwal"}} {
+		if args[opts[0]] != "" {
+			pools = append(pools, PoolConfig{URL: args[opts[0]], Wallet: args[opts[1]]})
 		}
-		time.Sleep(10 * time.Second)
 	}
+	return pools, nil
+}
+
+func (c *ClaymoreClient) PowerCycleEnabled() bool {
+	return c.ps != nil
+}
 
-	if err := c.ps.On(); err != nil {
-		return fmt.Errorf("failed to turn power on: %s", err)
+func (c *ClaymoreClient) PowerCycle() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
 	}
-	return nil
+	if c.ps == nil {
+		return fmt.Errorf("power cycle not enabled on this client, no power service available")
+	}
+	return cyclePower(c.ps)
 }
 
 func (c *ClaymoreClient) ReadOnly() bool {
@@ -0,0 +1,134 @@
+package mining_monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// ReplayClient plays back a recording made by a StatsRecorder, speed times faster than it was recorded. Every call
+// to Stats() returns the latest record due at the current replay time, so the monitor should run on the replay Clock. Reboots and power cycles succeed without changing the recording.
+type ReplayClient struct {
+	path         string
+	records      []StatsRecord
+	clock        Clock
+	readOnly     bool
+	failOnWrites bool
+
+	next int
+}
+
+// NewReplayClient replays the records of the given client from the recording. The client may be left empty when the
+// recording only holds a single client.
+func NewReplayClient(path, client string, speed float64) (Client, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stats recording %s: %s", path, err)
+	}
+	defer f.Close()
+	var records []StatsRecord
+	clients := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var record StatsRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse stats recording %s line %d: %s", path, n, err)
+		}
+		if client == "" {
+			clients[record.Client] = true
+		}
+		if client == "" || record.Client == client {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stats recording %s: %s", path, err)
+	}
+	if len(clients) > 1 {
+		var names []string
+		for name := range clients {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("stats recording %s holds clients %s, one must be chosen", path, strings.Join(names, ", "))
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("stats recording %s has no records of client %s", path, client)
+	}
+	return &ReplayClient{path: path, records: records, clock: NewScaledClock(records[0].Time, speed)}, nil
+}
+
+// Clock returns the replay time, which the client should be monitored on so intervals, windows and schedules pass
+// as they did during the recording.
+func (c *ReplayClient) Clock() Clock {
+	return c.clock
+}
+
+func (c *ReplayClient) Stats() (*Statistics, error) {
+	if c.next >= len(c.records) {
+		return nil, fmt.Errorf("replay of %s finished", c.path)
+	}
+	now := c.clock.Now()
+	for c.next < len(c.records) && !c.records[c.next].Time.After(now) {
+		c.next++
+	}
+	record := c.records[c.next-1]
+	glog.V(2).Infof("[%s] replaying record from %v", c.IP(), record.Time)
+	if record.Error != "" {
+		return nil, fmt.Errorf("%s", record.Error)
+	}
+	// collectors and thresholds modify the stats they are given, so every poll gets its own copy of the record
+	data, err := json.Marshal(record.Stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy record from %v: %s", record.Time, err)
+	}
+	var stats Statistics
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to copy record from %v: %s", record.Time, err)
+	}
+	return &stats, nil
+}
+
+func (c *ReplayClient) Reboot() error {
+	if c.readOnly && c.failOnWrites {
+		return fmt.Errorf("client is read only")
+	}
+	return nil
+}
+
+func (c *ReplayClient) Restart() error {
+	if c.readOnly && c.failOnWrites {
+		return fmt.Errorf("client is read only")
+	}
+	return nil
+}
+
+func (c *ReplayClient) PowerCycleEnabled() bool {
+	return true
+}
+
+func (c *ReplayClient) PowerCycle() error {
+	if c.readOnly && c.failOnWrites {
+		return fmt.Errorf("client is read only")
+	}
+	return nil
+}
+
+func (c *ReplayClient) SetReadOnly(readOnly, failOnWrites bool) {
+	c.readOnly = readOnly
+	c.failOnWrites = failOnWrites
+}
+
+func (c *ReplayClient) ReadOnly() bool {
+	return c.readOnly
+}
+
+func (c *ReplayClient) IP() string {
+	return c.path
+}
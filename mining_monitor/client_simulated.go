@@ -0,0 +1,417 @@
+package mining_monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	recoverOnReboot     = "reboot"
+	recoverOnPowerCycle = "powercycle"
+	recoverNever        = "never"
+)
+
+// Scenario scripts the behaviour of a SimulatedClient. It is read from a file with one directive per line, blank
+// lines and lines starting with # are ignored:
+//
+//	gpus <n>                                 number of GPUs, must come before any per GPU directive
+//	hashrate|temperature|fan <value> [gpu n] set the value of every GPU, or only GPU n
+//	power <watts>                            set the power draw reported by the simulated plug
+//	algorithm <name> <hashrate> [gpu n]      dual or triple mine another algorithm on every GPU, or only GPU n
+//	stats fail|ok                            make Stats() fail or succeed
+//	reboot fail <n>                          fail the next n reboots
+//	powercycle fail <n>                      fail the next n power cycles
+//	recover reboot|powercycle|never          what restores the rig to its initial state, reboot by default
+//	downtime <duration>                      how long the rig is unreachable after a reboot or power cycle
+//	at <duration> <directive>                apply the directive once the scenario has run for duration
+//
+// For example a rig whose GPU 2 stops hashing after 10 minutes, and which only recovers from a power cycle:
+//
+//	gpus 6
+//	hashrate 30000
+//	temperature 60
+//	fan 50
+//	downtime 1m
+//	recover powercycle
+//	at 10m hashrate 0 gpu 2
+type Scenario struct {
+	baseline []scenarioDirective
+	steps    []scenarioDirective
+}
+
+type scenarioDirective struct {
+	at    time.Duration
+	line  string
+	apply func(c *SimulatedClient)
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scenario %s: %s", path, err)
+	}
+	defer f.Close()
+	return ParseScenario(f)
+}
+
+func ParseScenario(r io.Reader) (*Scenario, error) {
+	scenario := &Scenario{}
+	gpus := 0
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] == "gpus" {
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("scenario line %d: expected gpus <n>", n)
+			}
+			count, err := strconv.Atoi(fields[1])
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("scenario line %d: invalid gpu count %s", n, fields[1])
+			}
+			gpus = count
+			scenario.baseline = append(scenario.baseline, scenarioDirective{line: line, apply: func(c *SimulatedClient) {
+				c.state.hashRates = make([]float64, count)
+				c.state.temperatures = make([]float64, count)
+				c.state.fanPercents = make([]float64, count)
+			}})
+			continue
+		}
+		directive := scenarioDirective{line: line}
+		scheduled := fields[0] == "at"
+		if scheduled {
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("scenario line %d: expected at <duration> <directive>", n)
+			}
+			at, err := time.ParseDuration(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("scenario line %d: invalid duration %s: %s", n, fields[1], err)
+			}
+			directive.at = at
+			fields = fields[2:]
+		}
+		apply, err := parseScenarioDirective(fields, gpus)
+		if err != nil {
+			return nil, fmt.Errorf("scenario line %d: %s", n, err)
+		}
+		directive.apply = apply
+		if scheduled {
+			scenario.steps = append(scenario.steps, directive)
+		} else {
+			scenario.baseline = append(scenario.baseline, directive)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %s", err)
+	}
+	if gpus == 0 {
+		return nil, fmt.Errorf("scenario must declare gpus <n>")
+	}
+	sort.SliceStable(scenario.steps, func(i, j int) bool { return scenario.steps[i].at < scenario.steps[j].at })
+	return scenario, nil
+}
+
+func parseScenarioDirective(fields []string, gpus int) (func(c *SimulatedClient), error) {
+	switch fields[0] {
+	case "hashrate", "temperature", "fan":
+		if gpus == 0 {
+			return nil, fmt.Errorf("%s must come after gpus <n>", fields[0])
+		}
+		if len(fields) != 2 && !(len(fields) == 4 && fields[2] == "gpu") {
+			return nil, fmt.Errorf("expected %s <value> [gpu n]", fields[0])
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %s", fields[0], fields[1], err)
+		}
+		gpu := -1
+		if len(fields) == 4 {
+			if gpu, err = strconv.Atoi(fields[3]); err != nil || gpu < 0 || gpu >= gpus {
+				return nil, fmt.Errorf("invalid gpu %s, only %d gpus declared", fields[3], gpus)
+			}
+		}
+		metric := fields[0]
+		return func(c *SimulatedClient) {
+			values := c.state.metric(metric)
+			for i := range values {
+				if gpu < 0 || gpu == i {
+					values[i] = value
+				}
+			}
+		}, nil
+	case "algorithm":
+		if gpus == 0 {
+			return nil, fmt.Errorf("%s must come after gpus <n>", fields[0])
+		}
+		if len(fields) != 3 && !(len(fields) == 5 && fields[3] == "gpu") {
+			return nil, fmt.Errorf("expected algorithm <name> <hashrate> [gpu n]")
+		}
+		hashRate, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s hashrate %s: %s", fields[1], fields[2], err)
+		}
+		gpu := -1
+		if len(fields) == 5 {
+			if gpu, err = strconv.Atoi(fields[4]); err != nil || gpu < 0 || gpu >= gpus {
+				return nil, fmt.Errorf("invalid gpu %s, only %d gpus declared", fields[4], gpus)
+			}
+		}
+		name := fields[1]
+		return func(c *SimulatedClient) {
+			hashRates := c.state.algorithm(name, gpus)
+			for i := range hashRates {
+				if gpu < 0 || gpu == i {
+					hashRates[i] = hashRate
+				}
+			}
+		}, nil
+	case "power":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected power <watts>")
+		}
+		power, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid power %s: %s", fields[1], err)
+		}
+		return func(c *SimulatedClient) { c.state.power = power }, nil
+	case "stats":
+		if len(fields) != 2 || (fields[1] != "fail" && fields[1] != "ok") {
+			return nil, fmt.Errorf("expected stats fail|ok")
+		}
+		fail := fields[1] == "fail"
+		return func(c *SimulatedClient) { c.state.statsFail = fail }, nil
+	case "reboot", "powercycle":
+		if len(fields) != 3 || fields[1] != "fail" {
+			return nil, fmt.Errorf("expected %s fail <n>", fields[0])
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s fail count %s: %s", fields[0], fields[2], err)
+		}
+		if fields[0] == "reboot" {
+			return func(c *SimulatedClient) { c.rebootFails = count }, nil
+		}
+		return func(c *SimulatedClient) { c.powerCycleFails = count }, nil
+	case "recover":
+		if len(fields) != 2 || (fields[1] != recoverOnReboot && fields[1] != recoverOnPowerCycle && fields[1] != recoverNever) {
+			return nil, fmt.Errorf("expected recover %s|%s|%s", recoverOnReboot, recoverOnPowerCycle, recoverNever)
+		}
+		recoverOn := fields[1]
+		return func(c *SimulatedClient) { c.recoverOn = recoverOn }, nil
+	case "downtime":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected downtime <duration>")
+		}
+		downtime, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid downtime %s: %s", fields[1], err)
+		}
+		return func(c *SimulatedClient) { c.downtime = downtime }, nil
+	}
+	return nil, fmt.Errorf("unknown directive %s", fields[0])
+}
+
+type simulatedState struct {
+	hashRates    []float64
+	temperatures []float64
+	fanPercents  []float64
+	power        float64
+	statsFail    bool
+
+	// algorithms are the per GPU hashrates of the algorithms mined besides the main one, in the order declared
+	algorithms []simulatedAlgorithm
+}
+
+type simulatedAlgorithm struct {
+	name      string
+	hashRates []float64
+}
+
+// algorithm returns the per GPU hashrates of an algorithm mined besides the main one, adding it if needed.
+func (s *simulatedState) algorithm(name string, gpus int) []float64 {
+	for _, a := range s.algorithms {
+		if a.name == name {
+			return a.hashRates
+		}
+	}
+	s.algorithms = append(s.algorithms, simulatedAlgorithm{name: name, hashRates: make([]float64, gpus)})
+	return s.algorithms[len(s.algorithms)-1].hashRates
+}
+
+func (s simulatedState) metric(name string) []float64 {
+	switch name {
+	case "hashrate":
+		return s.hashRates
+	case "temperature":
+		return s.temperatures
+	default:
+		return s.fanPercents
+	}
+}
+
+func (s simulatedState) copy() simulatedState {
+	s.hashRates = append([]float64(nil), s.hashRates...)
+	s.temperatures = append([]float64(nil), s.temperatures...)
+	s.fanPercents = append([]float64(nil), s.fanPercents...)
+	algorithms := s.algorithms
+	s.algorithms = nil
+	for _, a := range algorithms {
+		s.algorithms = append(s.algorithms, simulatedAlgorithm{name: a.name, hashRates: append([]float64(nil), a.hashRates...)})
+	}
+	return s
+}
+
+// SimulatedClient is a Client backed by a Scenario instead of a real rig, for testing threshold and remediation
+// configurations end to end. Scenario time runs speed times faster than real time.
+type SimulatedClient struct {
+	name         string
+	scenario     *Scenario
+	speed        float64
+	readOnly     bool
+	failOnWrites bool
+
+	start    time.Time
+	nextStep int
+	baseline simulatedState
+	state    simulatedState
+
+	rebootFails     int
+	powerCycleFails int
+	recoverOn       string
+	downtime        time.Duration
+	downUntil       time.Duration
+	bootedAt        time.Duration
+}
+
+func NewSimulatedClient(name string, scenario *Scenario, speed float64) Client {
+	c := &SimulatedClient{name: name, scenario: scenario, speed: speed, start: time.Now(), recoverOn: recoverOnReboot}
+	for _, d := range scenario.baseline {
+		d.apply(c)
+	}
+	c.baseline = c.state.copy()
+	return c
+}
+
+// elapsed returns the scenario time, applying every step which is due.
+func (c *SimulatedClient) elapsed() time.Duration {
+	now := time.Duration(float64(time.Since(c.start)) * c.speed)
+	for ; c.nextStep < len(c.scenario.steps) && c.scenario.steps[c.nextStep].at <= now; c.nextStep++ {
+		step := c.scenario.steps[c.nextStep]
+		glog.Infof("[%s] scenario %v: %s", c.name, now, step.line)
+		step.apply(c)
+	}
+	return now
+}
+
+func (c *SimulatedClient) Stats() (*Statistics, error) {
+	now := c.elapsed()
+	if now < c.downUntil {
+		return nil, fmt.Errorf("simulated rig %s is unreachable", c.name)
+	}
+	if c.state.statsFail {
+		return nil, fmt.Errorf("simulated rig %s failed to return stats", c.name)
+	}
+	stats := &Statistics{
+		Version:         "simulated",
+		RunningTime:     int((now - c.bootedAt).Minutes()),
+		GpuTemperatures: append([]float64(nil), c.state.temperatures...),
+		GpuFanPercents:  append([]float64(nil), c.state.fanPercents...),
+		MainMiningPool:  "simulated",
+		MainGpuHashRate: append([]float64(nil), c.state.hashRates...),
+		PowerState:      &PowerState{On: true, Power: c.state.power},
+	}
+	for _, hash := range stats.MainGpuHashRate {
+		stats.MainHashRate += hash
+	}
+	algorithms := []AlgorithmStats{{Pool: stats.MainMiningPool, HashRate: stats.MainHashRate, GpuHashRate: stats.MainGpuHashRate}}
+	for _, a := range c.state.algorithms {
+		algorithm := AlgorithmStats{Algorithm: a.name, Pool: "simulated", GpuHashRate: append([]float64(nil), a.hashRates...)}
+		for _, hash := range a.hashRates {
+			algorithm.HashRate += hash
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	stats.SetAlgorithms(algorithms)
+	glog.V(3).Infof("[%s] Stats: %+v", c.IP(), stats)
+	return stats, nil
+}
+
+// restart takes the rig offline for the downtime, restoring its initial state if the scenario recovers from it.
+func (c *SimulatedClient) restart(recovers bool) {
+	now := c.elapsed()
+	c.downUntil = now + c.downtime
+	c.bootedAt = now
+	if recovers {
+		c.state = c.baseline.copy()
+	}
+}
+
+func (c *SimulatedClient) Reboot() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	c.elapsed()
+	if c.rebootFails > 0 {
+		c.rebootFails--
+		return fmt.Errorf("simulated reboot failure")
+	}
+	c.restart(c.recoverOn == recoverOnReboot)
+	return nil
+}
+
+func (c *SimulatedClient) Restart() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	return nil
+}
+
+func (c *SimulatedClient) PowerCycleEnabled() bool {
+	return true
+}
+
+func (c *SimulatedClient) PowerCycle() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	c.elapsed()
+	if c.powerCycleFails > 0 {
+		c.powerCycleFails--
+		return fmt.Errorf("simulated power cycle failure")
+	}
+	c.restart(c.recoverOn != recoverNever)
+	return nil
+}
+
+func (c *SimulatedClient) SetReadOnly(readOnly, failOnWrites bool) {
+	c.readOnly = readOnly
+	c.failOnWrites = failOnWrites
+}
+
+func (c *SimulatedClient) ReadOnly() bool {
+	return c.readOnly
+}
+
+func (c *SimulatedClient) IP() string {
+	return c.name
+}
@@ -0,0 +1,105 @@
+package mining_monitor
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// whatsminerMHsPerGHs converts the MH/s Whatsminers report to the GH/s Antminers report.
+const whatsminerMHsPerGHs = 1000
+
+// WhatsminerClient monitors MicroBT Whatsminers through their cgminer compatible API, which reports hashrates in MH/s
+// and hashboards as devs instead of chains. Hashrates are converted to GH/s to match Antminers. Reboots and restarts
+// require the encrypted admin API, and are not supported.
+type WhatsminerClient struct {
+	addr         string
+	readOnly     bool
+	failOnWrites bool
+}
+
+func NewWhatsminerClient(addr string) Client {
+	return &WhatsminerClient{addr: addr}
+}
+
+func (c *WhatsminerClient) SetReadOnly(readOnly, failOnWrites bool) {
+	c.readOnly = readOnly
+	c.failOnWrites = failOnWrites
+}
+
+// whatsminerBoards builds the statistics of every hashboard reported in the devs reply.
+func whatsminerBoards(devs []map[string]interface{}) []BoardStats {
+	var boards []BoardStats
+	for i, dev := range devs {
+		board := BoardStats{Chain: i}
+		if slot, ok := cgminerFloat(dev["Slot"]); ok {
+			board.Chain = int(slot)
+		}
+		rate, _ := cgminerFloat(dev["MHS 5s"])
+		board.HashRate = rate / whatsminerMHsPerGHs
+		board.Chips, _ = cgminerFloat(dev["Effective Chips"])
+		board.Temperature, _ = cgminerFloat(dev["Temperature"])
+		board.ChipTemperature, _ = cgminerFloat(dev["Chip Temp Max"])
+		boards = append(boards, board)
+	}
+	return boards
+}
+
+func (c *WhatsminerClient) Stats() (*Statistics, error) {
+	summary, err := cgminerCommand(c.addr, "summary")
+	if err != nil {
+		return nil, err
+	}
+	if len(summary.Summary) == 0 {
+		return nil, fmt.Errorf("empty summary from remote addr %s", c.addr)
+	}
+	stats := &Statistics{}
+	elapsed, _ := cgminerFloat(summary.Summary[0]["Elapsed"])
+	stats.RunningTime = int(elapsed / 60)
+	rate, ok := cgminerFloat(summary.Summary[0]["MHS 5s"])
+	if !ok {
+		return nil, fmt.Errorf("no hashrate in summary from remote addr %s, not a Whatsminer", c.addr)
+	}
+	stats.MainHashRate = rate / whatsminerMHsPerGHs
+	accepted, _ := cgminerFloat(summary.Summary[0]["Accepted"])
+	rejected, _ := cgminerFloat(summary.Summary[0]["Rejected"])
+	stats.MainShares = int(accepted)
+	stats.MainRejectedShares = int(rejected)
+
+	devs, err := cgminerCommand(c.addr, "devs")
+	if err != nil {
+		return nil, err
+	}
+	stats.Boards = whatsminerBoards(devs.Devs)
+
+	if stats.MainMiningPool, err = cgminerActivePool(c.addr); err != nil {
+		return nil, err
+	}
+	stats.setMainAltAlgorithms()
+	glog.V(3).Infof("[%s] Stats: %+v", c.IP(), stats)
+	return stats, nil
+}
+
+func (c *WhatsminerClient) Reboot() error {
+	return fmt.Errorf("reboot is not supported on Whatsminers")
+}
+
+func (c *WhatsminerClient) Restart() error {
+	return fmt.Errorf("restart is not supported on Whatsminers")
+}
+
+func (c *WhatsminerClient) PowerCycleEnabled() bool {
+	return false
+}
+
+func (c *WhatsminerClient) PowerCycle() error {
+	return fmt.Errorf("power cycle not enabled on this client, no power service available")
+}
+
+func (c *WhatsminerClient) ReadOnly() bool {
+	return c.readOnly
+}
+
+func (c *WhatsminerClient) IP() string {
+	return c.addr
+}
@@ -0,0 +1,51 @@
+package mining_monitor
+
+import "time"
+
+// Clock is the time the monitor, thresholds and collectors measure intervals and windows against. Durations such
+// as the stats interval are in clock time, and converted to wall clock time to wait for them, so a replay running
+// faster than the wall clock only needs a faster clock.
+type Clock interface {
+	Now() time.Time
+	// Wall converts a duration on the clock to the wall clock duration it takes to pass.
+	Wall(d time.Duration) time.Duration
+}
+
+type wallClock struct{}
+
+// NewWallClock returns the wall clock, which the monitor runs on by default.
+func NewWallClock() Clock {
+	return wallClock{}
+}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) Wall(d time.Duration) time.Duration {
+	return d
+}
+
+type scaledClock struct {
+	origin     time.Time
+	wallOrigin time.Time
+	speed      float64
+}
+
+// NewScaledClock returns a clock which reads origin now, and runs speed times faster than the wall clock.
+func NewScaledClock(origin time.Time, speed float64) Clock {
+	return &scaledClock{origin: origin, wallOrigin: time.Now(), speed: speed}
+}
+
+func (c *scaledClock) Now() time.Time {
+	return c.origin.Add(time.Duration(float64(time.Since(c.wallOrigin)) * c.speed))
+}
+
+func (c *scaledClock) Wall(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.speed)
+}
+
+// clocked is implemented by collectors which measure time, so the monitor can run them on the client's clock.
+type clocked interface {
+	setClock(clock Clock)
+}
@@ -0,0 +1,6 @@
+package mining_monitor
+
+// Collector enriches the statistics returned by a client with data the miner itself does not report.
+type Collector interface {
+	Collect(stats *Statistics) error
+}
@@ -0,0 +1,203 @@
+package mining_monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const hiveOSAPI = "https://api2.hiveos.farm/api/v2"
+
+// ConfigPusher applies a pool, wallet or overclocking configuration change to a rig, restarting the miner for it to
+// take effect.
+type ConfigPusher interface {
+	PushConfig() error
+}
+
+// ConfigRollbacker is implemented by ConfigPushers which can restore the configuration they replaced.
+type ConfigRollbacker interface {
+	RollbackConfig() error
+}
+
+type claymoreConfigPusher struct {
+	c        *ClaymoreClient
+	file     string
+	data     []byte
+	previous []byte
+}
+
+// NewClaymoreConfigPusher replaces a file in the Claymore miner directory through the remote management API, keeping
+// the previous file to roll back to.
+func NewClaymoreConfigPusher(c Client, file string, data []byte) (ConfigPusher, error) {
+	claymore, ok := c.(*ClaymoreClient)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a claymore client", c.IP())
+	}
+	return &claymoreConfigPusher{c: claymore, file: file, data: data}, nil
+}
+
+func (p *claymoreConfigPusher) PushConfig() error {
+	previous, err := p.c.ReadFile(p.file)
+	if err != nil {
+		return fmt.Errorf("failed to read previous %s: %s", p.file, err)
+	}
+	p.previous = previous
+	return p.c.WriteFile(p.file, p.data)
+}
+
+func (p *claymoreConfigPusher) RollbackConfig() error {
+	if p.previous == nil {
+		return fmt.Errorf("%s was not pushed, nothing to roll back", p.file)
+	}
+	return p.c.WriteFile(p.file, p.previous)
+}
+
+type sshConfigPusher struct {
+	sh         ShellService
+	path       string
+	data       []byte
+	restartCmd string
+}
+
+// NewSSHConfigPusher replaces the config file at path on the rig, keeping the previous one as path.bak, then runs
+// restartCmd to restart the miner.
+func NewSSHConfigPusher(sh ShellService, path string, data []byte, restartCmd string) ConfigPusher {
+	return &sshConfigPusher{sh: sh, path: path, data: data, restartCmd: restartCmd}
+}
+
+func (p *sshConfigPusher) PushConfig() error {
+	tmp := p.path + ".new"
+	if err := p.sh.Upload(tmp, p.data); err != nil {
+		return err
+	}
+	// a backup left by an earlier push is removed so a rollback never restores it
+	if _, err := p.sh.Run(fmt.Sprintf("rm -f '%s.bak'; cp -p '%s' '%s.bak'; mv '%s' '%s'", p.path, p.path, p.path, tmp, p.path)); err != nil {
+		return fmt.Errorf("failed to replace %s: %s", p.path, err)
+	}
+	if _, err := p.sh.Run(p.restartCmd); err != nil {
+		return fmt.Errorf("failed to restart miner: %s", err)
+	}
+	return nil
+}
+
+// RollbackConfig restores path.bak and restarts the miner.
+func (p *sshConfigPusher) RollbackConfig() error {
+	if _, err := p.sh.Run(fmt.Sprintf("mv -f '%s.bak' '%s'", p.path, p.path)); err != nil {
+		return fmt.Errorf("failed to restore %s.bak: %s", p.path, err)
+	}
+	if _, err := p.sh.Run(p.restartCmd); err != nil {
+		return fmt.Errorf("failed to restart miner: %s", err)
+	}
+	return nil
+}
+
+type hiveOSConfigPusher struct {
+	token       string
+	farmID      int
+	workerID    int
+	flightSheet int
+	http        *http.Client
+}
+
+// NewHiveOSConfigPusher applies a HiveOS flight sheet to a worker through the HiveOS API. Flight sheets are not rolled
+// back, as HiveOS keeps the history of a worker.
+func NewHiveOSConfigPusher(token string, farmID, workerID, flightSheet int) ConfigPusher {
+	return &hiveOSConfigPusher{token: token, farmID: farmID, workerID: workerID, flightSheet: flightSheet,
+		http: &http.Client{Timeout: httpTimeout}}
+}
+
+func (p *hiveOSConfigPusher) PushConfig() error {
+	body, err := json.Marshal(map[string]int{"fs_id": p.flightSheet})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/farms/%d/workers/%d", hiveOSAPI, p.farmID, p.workerID)
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to apply flight sheet %d to worker %d: %s", p.flightSheet, p.workerID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("failed to apply flight sheet %d to worker %d: %s %s", p.flightSheet, p.workerID, resp.Status,
+			strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
+
+type configClient struct {
+	Client
+	ConfigPusher
+}
+
+// NewConfigClient pairs a client used to verify a rig with the ConfigPusher used to change its configuration.
+func NewConfigClient(c Client, p ConfigPusher) Client {
+	return &configClient{Client: c, ConfigPusher: p}
+}
+
+func (c *configClient) RollbackConfig() error {
+	r, ok := c.ConfigPusher.(ConfigRollbacker)
+	if !ok {
+		return fmt.Errorf("configuration rollback is not supported by %s", c.IP())
+	}
+	return r.RollbackConfig()
+}
+
+func pushConfig(c Client) error {
+	if c.ReadOnly() {
+		return fmt.Errorf("client is read only")
+	}
+	p, ok := c.(ConfigPusher)
+	if !ok {
+		return fmt.Errorf("configuration changes are not supported by %s", c.IP())
+	}
+	return p.PushConfig()
+}
+
+func rollbackConfig(c Client) error {
+	if c.ReadOnly() {
+		return fmt.Errorf("client is read only")
+	}
+	r, ok := c.(ConfigRollbacker)
+	if !ok {
+		return fmt.Errorf("configuration rollback is not supported by %s", c.IP())
+	}
+	return r.RollbackConfig()
+}
+
+// NewConfigRollout returns a Rollout pushing the configuration paired with each client by NewConfigClient. Rigs must
+// reconnect after the push, accepting shares from a pool containing expectPool if it is given, otherwise their
+// previous configuration is restored.
+func NewConfigRollout(name, expectPool string, batchSize int, thresholds []*Threshold, recoveryTimeout time.Duration,
+	es *EventService) *Rollout {
+	return &Rollout{
+		Name:            fmt.Sprintf("config push %s", path.Base(name)),
+		BatchSize:       batchSize,
+		Thresholds:      thresholds,
+		RecoveryTimeout: recoveryTimeout,
+		PollInterval:    rolloutPollInterval,
+		EventService:    es,
+		Apply:           pushConfig,
+		Rollback:        rollbackConfig,
+		Verify: func(stats *Statistics) error {
+			if expectPool != "" && !strings.Contains(stats.MainMiningPool, expectPool) {
+				return fmt.Errorf("mining to %s instead of %s", stats.MainMiningPool, expectPool)
+			}
+			if stats.MainShares == 0 {
+				return fmt.Errorf("no shares accepted since restarting")
+			}
+			return nil
+		},
+	}
+}
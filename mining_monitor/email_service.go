@@ -1,14 +1,19 @@
 package mining_monitor
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 	"time"
 )
 
 type EmailService interface {
 	SendEmail(subject, body string) error
+	SendHTMLEmail(subject, html string, attachments []Attachment) error
 
 	SetMaxEmails(max int, interval time.Duration)
 }
@@ -42,7 +47,14 @@ func NewGMailService(host, from string, to []string, username, password string,
 	}
 }
 
-func (e *GMailService) SendEmail(subject, msg string) error {
+// Attachment is a file attached to an email.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+func (e *GMailService) limit() error {
 	if e.max > 0 {
 		if time.Since(e.lastSent) > e.interval {
 			e.sent = 0
@@ -52,6 +64,21 @@ func (e *GMailService) SendEmail(subject, msg string) error {
 			e.sent++
 		}
 	}
+	return nil
+}
+
+func (e *GMailService) send(body []byte) error {
+	auth := smtp.PlainAuth("", e.from, e.password, e.host)
+	if err := smtp.SendMail(fmt.Sprintf("%s:%d", e.host, e.port), auth, e.from, e.to, body); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *GMailService) SendEmail(subject, msg string) error {
+	if err := e.limit(); err != nil {
+		return err
+	}
 	body := fmt.Sprintf(
 		"To: %s\r\n"+
 			"Subject: %s\r\n"+
@@ -59,11 +86,52 @@ func (e *GMailService) SendEmail(subject, msg string) error {
 			"%s",
 		strings.Join(e.to, ","), subject, msg,
 	)
-	auth := smtp.PlainAuth("", e.from, e.password, e.host)
-	if err := smtp.SendMail(fmt.Sprintf("%s:%d", e.host, e.port), auth, e.from, e.to, []byte(body)); err != nil {
+	return e.send([]byte(body))
+}
+
+// SendHTMLEmail sends a multipart MIME email with an HTML body followed by the attachments.
+func (e *GMailService) SendHTMLEmail(subject, html string, attachments []Attachment) error {
+	if err := e.limit(); err != nil {
 		return err
 	}
-	return nil
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fmt.Fprintf(&body,
+		"To: %s\r\n"+
+			"Subject: %s\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: multipart/mixed; boundary=%s\r\n"+
+			"\r\n",
+		strings.Join(e.to, ","), subject, w.Boundary(),
+	)
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write([]byte(html)); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", a.Name)},
+		})
+		if err != nil {
+			return err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		// base64 bodies must be wrapped at 76 characters
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return e.send(body.Bytes())
 }
 
 func (e *GMailService) SetMaxEmails(max int, interval time.Duration) {
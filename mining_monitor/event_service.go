@@ -1,6 +1,15 @@
 package mining_monitor
 
-import "github.com/golang/glog"
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// eventHeartbeatInterval is how often an idle event loop reports it is healthy.
+const eventHeartbeatInterval = 10 * time.Second
 
 const (
 	LogType = iota
@@ -15,6 +24,10 @@ type Event struct {
 	Subject string
 	Message string
 	Error   error
+
+	// HTML is sent instead of the message by email services, which other sinks receive as a summary
+	HTML        string
+	Attachments []Attachment
 }
 
 func NewLogEvent(c Client, message string) Event {
@@ -25,17 +38,32 @@ func NewEmailEvent(c Client, subject, message string) Event {
 	return Event{Client: c, Type: EmailType, Subject: subject, Message: message}
 }
 
+// NewHTMLEmailEvent sends an HTML email, the message summarises it for sinks which can not display HTML.
+func NewHTMLEmailEvent(c Client, subject, message, html string, attachments []Attachment) Event {
+	return Event{Client: c, Type: EmailType, Subject: subject, Message: message, HTML: html, Attachments: attachments}
+}
+
 func NewErrorEvent(c Client, err error) Event {
 	return Event{Client: c, Type: ErrorType, Error: err}
 }
 
+// EventSink receives every event handled by the EventService, such as to forward them to a system log.
+type EventSink interface {
+	Handle(e Event) error
+}
+
 type EventService struct {
 	E            chan Event
 	EmailService EmailService
 
 	logs   []string
 	errors []error
+	sinks  []EventSink
 	stop   chan bool
+	done   chan bool
+
+	mu        sync.Mutex
+	heartbeat time.Time
 }
 
 func NewEventServiceWithEmail(es EmailService) *EventService {
@@ -43,6 +71,7 @@ func NewEventServiceWithEmail(es EmailService) *EventService {
 		E:            make(chan Event, 100),
 		EmailService: es,
 		stop:         make(chan bool, 1),
+		done:         make(chan bool),
 	}
 }
 
@@ -50,40 +79,98 @@ func NewEventService() *EventService {
 	return &EventService{
 		E:    make(chan Event, 100),
 		stop: make(chan bool, 1),
+		done: make(chan bool),
 	}
 }
 
 func (es *EventService) Start() {
+	heartbeats := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeats.Stop()
+	es.beat()
 	for {
 		select {
 		case event := <-es.E:
-			switch event.Type {
-			case LogType:
-				es.logs = append(es.logs, event.Message)
-				glog.Infof("[%s]: %s", event.Client.IP(), event.Message)
-			case ErrorType:
-				es.errors = append(es.errors, event.Error)
-				glog.Infof("[%s] Error: %s", event.Client.IP(), event.Error)
-			case EmailType:
-				if es.EmailService == nil {
-					glog.Infof("email service not initialized, no email sent")
-				} else {
-					if err := es.EmailService.SendEmail(event.Subject, event.Message); err != nil {
-						glog.Infof("unable to send email: %s", err)
-					} else {
-						glog.Infof("[%s]: successfully sent email", event.Client.IP())
-					}
+			es.handle(event)
+			es.beat()
+		case <-heartbeats.C:
+			es.beat()
+		case <-es.stop:
+			// handle the events still queued so none are lost on shutdown
+			for {
+				select {
+				case event := <-es.E:
+					es.handle(event)
+				default:
+					glog.Infof("Event Service stopped")
+					es.done <- true
+					return
 				}
-			default:
-				glog.Infof("[%s]: unknown event recieved %+v", event.Client.IP(), event)
 			}
-		case <-es.stop:
-			glog.Infof("Event Service stopped")
-			return
 		}
 	}
 }
 
+func (es *EventService) handle(event Event) {
+	switch event.Type {
+	case LogType:
+		es.logs = append(es.logs, event.Message)
+		glog.Infof("[%s]: %s", event.Client.IP(), event.Message)
+	case ErrorType:
+		es.errors = append(es.errors, event.Error)
+		glog.Infof("[%s] Error: %s", event.Client.IP(), event.Error)
+	case EmailType:
+		if es.EmailService == nil {
+			glog.Infof("email service not initialized, no email sent")
+		} else {
+			var err error
+			if event.HTML != "" {
+				err = es.EmailService.SendHTMLEmail(event.Subject, event.HTML, event.Attachments)
+			} else {
+				err = es.EmailService.SendEmail(event.Subject, event.Message)
+			}
+			if err != nil {
+				glog.Infof("unable to send email: %s", err)
+			} else {
+				glog.Infof("[%s]: successfully sent email", event.Client.IP())
+			}
+		}
+	default:
+		glog.Infof("[%s]: unknown event recieved %+v", event.Client.IP(), event)
+	}
+	for _, sink := range es.sinks {
+		if err := sink.Handle(event); err != nil {
+			glog.Infof("unable to forward event to sink: %s", err)
+		}
+	}
+}
+
+func (es *EventService) beat() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.heartbeat = time.Now()
+}
+
+// Healthy returns an error if the event loop has stopped making progress, such as when an email or sink never
+// returns.
+func (es *EventService) Healthy() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.heartbeat.IsZero() {
+		return nil
+	}
+	if since := time.Since(es.heartbeat); since > eventHeartbeatInterval+loopGracePeriod {
+		return fmt.Errorf("event loop has not made progress in %v", since)
+	}
+	return nil
+}
+
+// AddSink must be called before the EventService is started.
+func (es *EventService) AddSink(sink EventSink) {
+	es.sinks = append(es.sinks, sink)
+}
+
+// Stop blocks until every queued event has been handled.
 func (es *EventService) Stop() {
 	es.stop <- true
+	<-es.done
 }
@@ -0,0 +1,571 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	nvidiaSettings = "DISPLAY=:0 nvidia-settings"
+	nvidiaSmiQuery = "nvidia-smi --format=csv,noheader,nounits --query-gpu="
+	amdHwmonPath   = "/sys/class/drm/card%d/device/hwmon/hwmon*"
+	xpuSmi         = "xpu-smi"
+	// drmCards lists the index of every card with a hwmon device followed by the requested attributes, "-" when
+	// the attribute is not available
+	drmCards = "for c in /sys/class/drm/card[0-9] /sys/class/drm/card[0-9][0-9]; do " +
+		"for d in $c/device/hwmon/hwmon*; do [ -d $d ] || continue; echo ${c#/sys/class/drm/card}%s; done; done"
+)
+
+// nvidiaFan matches the fans listed by nvidia-settings -q [gpu:n]/fans, e.g. "[0] rig:0[fan:1] (FAN-1)"
+var nvidiaFan = regexp.MustCompile(`\[fan:(\d+)\]`)
+
+// GpuService controls and collects statistics from the GPUs of a rig. GPUs are addressed by the same index the
+// miner reports them under.
+type GpuService interface {
+	Collector
+
+	SetFanPercent(gpu int, percent float64) error
+	ResetFan(gpu int) error
+	SetPowerLimit(gpu int, watts float64) error
+	// SetClockOffsets offsets the core and memory clocks from their defaults, 0 restores the default clocks.
+	SetClockOffsets(gpu int, coreMHz, memoryMHz float64) error
+	// ClockOffsets returns the current core and memory clock offsets.
+	ClockOffsets(gpu int) (coreMHz, memoryMHz float64, err error)
+}
+
+// parseGpuNames parses lines of the form "index<sep>name", calling set with each name which is not reported as
+// unavailable. Names may contain spaces, and when sep is empty the index is separated from the name by whitespace.
+func parseGpuNames(out, sep string, set func(gpu int, name string)) error {
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var fields []string
+		if sep == "" {
+			fields = strings.SplitN(strings.TrimSpace(line), " ", 2)
+		} else {
+			fields = strings.SplitN(line, sep, 2)
+		}
+		gpu, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return fmt.Errorf("failed to parse gpu index from %s: %s", line, err)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.TrimSpace(fields[1])
+		if name == "" || name == "-" || strings.Contains(name, "N/A") {
+			continue
+		}
+		set(gpu, name)
+	}
+	return nil
+}
+
+// parseGpuTable parses whitespace or comma separated lines of the form "index value...", calling set with each
+// value which is not reported as unavailable.
+func parseGpuTable(out, sep string, set func(gpu, column int, value float64)) error {
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var fields []string
+		if sep == "" {
+			fields = strings.Fields(line)
+		} else {
+			fields = strings.Split(line, sep)
+		}
+		gpu, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return fmt.Errorf("failed to parse gpu index from %s: %s", line, err)
+		}
+		for column, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if field == "-" || strings.Contains(field, "N/A") || strings.Contains(field, "Not Supported") {
+				continue
+			}
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse gpu %d value from %s: %s", gpu, line, err)
+			}
+			set(gpu, column, value)
+		}
+	}
+	return nil
+}
+
+type NvidiaGpuService struct {
+	sh ShellService
+}
+
+func NewNvidiaGpuService(sh ShellService) GpuService {
+	return &NvidiaGpuService{sh: sh}
+}
+
+// fans returns the index of every fan the GPU owns. Fans are numbered across all GPUs, so on cards with more than
+// one fan the fan indices do not match the GPU index.
+func (n *NvidiaGpuService) fans(gpu int) ([]int, error) {
+	out, err := n.sh.Run(fmt.Sprintf("%s -q [gpu:%d]/fans", nvidiaSettings, gpu))
+	if err != nil {
+		return nil, err
+	}
+	var fans []int
+	seen := map[int]bool{}
+	for _, m := range nvidiaFan.FindAllStringSubmatch(out, -1) {
+		fan, err := strconv.Atoi(m[1])
+		if err != nil || seen[fan] {
+			continue
+		}
+		seen[fan] = true
+		fans = append(fans, fan)
+	}
+	if len(fans) == 0 {
+		return nil, fmt.Errorf("no fans found for GPU %d", gpu)
+	}
+	return fans, nil
+}
+
+func (n *NvidiaGpuService) SetFanPercent(gpu int, percent float64) error {
+	fans, err := n.fans(gpu)
+	if err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("%s -a [gpu:%d]/GPUFanControlState=1", nvidiaSettings, gpu)
+	for _, fan := range fans {
+		cmd += fmt.Sprintf(" -a [fan:%d]/GPUTargetFanSpeed=%d", fan, int(math.Ceil(percent)))
+	}
+	_, err = n.sh.Run(cmd)
+	return err
+}
+
+func (n *NvidiaGpuService) ResetFan(gpu int) error {
+	_, err := n.sh.Run(fmt.Sprintf("%s -a [gpu:%d]/GPUFanControlState=0", nvidiaSettings, gpu))
+	return err
+}
+
+func (n *NvidiaGpuService) SetPowerLimit(gpu int, watts float64) error {
+	_, err := n.sh.Run(fmt.Sprintf("sudo -n nvidia-smi -i %d -pl %0.0f", gpu, watts))
+	return err
+}
+
+func (n *NvidiaGpuService) SetClockOffsets(gpu int, coreMHz, memoryMHz float64) error {
+	// performance level 3 is the level GPUs run at under a mining load
+	_, err := n.sh.Run(fmt.Sprintf("%s -a [gpu:%d]/GPUGraphicsClockOffset[3]=%0.0f -a [gpu:%d]/GPUMemoryTransferRateOffset[3]=%0.0f",
+		nvidiaSettings, gpu, coreMHz, gpu, memoryMHz))
+	return err
+}
+
+func (n *NvidiaGpuService) ClockOffsets(gpu int) (float64, float64, error) {
+	out, err := n.sh.Run(fmt.Sprintf("%s -t -q [gpu:%d]/GPUGraphicsClockOffset[3] -q [gpu:%d]/GPUMemoryTransferRateOffset[3]",
+		nvidiaSettings, gpu, gpu))
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("failed to parse GPU %d clock offsets from %s", gpu, out)
+	}
+	core, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse GPU %d core clock offset from %s: %s", gpu, out, err)
+	}
+	memory, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse GPU %d memory clock offset from %s: %s", gpu, out, err)
+	}
+	return core, memory, nil
+}
+
+func (n *NvidiaGpuService) Collect(stats *Statistics) error {
+	// names are queried on their own as they are the only values which are not numbers
+	out, err := n.sh.Run(nvidiaSmiQuery + "index,name")
+	if err != nil {
+		return err
+	}
+	if err := parseGpuNames(out, ",", func(gpu int, name string) {
+		stats.GpuModels = setStringAt(stats.GpuModels, gpu, name)
+	}); err != nil {
+		return err
+	}
+	out, err = n.sh.Run(nvidiaSmiQuery + "index,temperature.memory,power.draw,power.limit," +
+		"ecc.errors.corrected.aggregate.total,ecc.errors.uncorrected.aggregate.total," +
+		"retired_pages.single_bit_ecc.count,retired_pages.double_bit.count," +
+		"pcie.link.width.current,pcie.link.gen.current,pcie.link.width.max,pcie.link.gen.max")
+	if err != nil {
+		return err
+	}
+	return parseGpuTable(out, ",", func(gpu, column int, value float64) {
+		switch column {
+		case 0:
+			stats.GpuMemoryTemperatures = setFloatAt(stats.GpuMemoryTemperatures, gpu, value)
+		case 1:
+			stats.GpuPowers = setFloatAt(stats.GpuPowers, gpu, value)
+		case 2:
+			stats.GpuPowerLimits = setFloatAt(stats.GpuPowerLimits, gpu, value)
+		case 3, 4:
+			stats.GpuMemoryErrors = setFloatAt(stats.GpuMemoryErrors, gpu, floatAt(stats.GpuMemoryErrors, gpu)+value)
+		case 5, 6:
+			stats.GpuRetiredPages = setFloatAt(stats.GpuRetiredPages, gpu, floatAt(stats.GpuRetiredPages, gpu)+value)
+		case 7:
+			stats.GpuPcieLinkWidths = setFloatAt(stats.GpuPcieLinkWidths, gpu, value)
+		case 8:
+			stats.GpuPcieLinkGens = setFloatAt(stats.GpuPcieLinkGens, gpu, value)
+		case 9:
+			stats.GpuPcieLinkMaxWidths = setFloatAt(stats.GpuPcieLinkMaxWidths, gpu, value)
+		case 10:
+			stats.GpuPcieLinkMaxGens = setFloatAt(stats.GpuPcieLinkMaxGens, gpu, value)
+		}
+	})
+}
+
+// pciGpus lists every DRM card as "card bus-id vendor-id", e.g. "1 0000:03:00.0 0x8086"
+const pciGpus = "for c in /sys/class/drm/card[0-9] /sys/class/drm/card[0-9][0-9]; do [ -e $c/device/vendor ] || continue; " +
+	"echo ${c#/sys/class/drm/card} $(basename $(readlink -f $c/device)) $(cat $c/device/vendor); done"
+
+const (
+	amdVendorID   = "0x1002"
+	intelVendorID = "0x8086"
+	// integratedGpuBus is the root complex bus, GPUs on it are integrated into the CPU and are not mined on
+	integratedGpuBus = "0000:00:"
+)
+
+// pciGpu is a DRM card matched to the miner's GPU index. device is the xpu-smi device id of Intel GPUs, -1 when
+// unknown.
+type pciGpu struct {
+	card   int
+	busID  string
+	device int
+}
+
+// vendorGpus returns the cards of a vendor by their miner GPU index. DRM card numbers follow driver load order and
+// count integrated GPUs, while miners number GPUs of all vendors in PCI bus order, so cards are matched to the
+// miner's GPU indices by PCI bus id.
+func vendorGpus(sh ShellService, vendor string) (map[int]*pciGpu, error) {
+	out, err := sh.Run(pciGpus)
+	if err != nil {
+		return nil, err
+	}
+	var all []pciGpu
+	vendors := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(fields[1], integratedGpuBus) {
+			continue
+		}
+		card, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse drm card from %s: %s", line, err)
+		}
+		all = append(all, pciGpu{card: card, busID: strings.ToLower(fields[1]), device: -1})
+		vendors[strings.ToLower(fields[1])] = fields[2]
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].busID < all[b].busID })
+	gpus := map[int]*pciGpu{}
+	for index := range all {
+		if vendors[all[index].busID] == vendor {
+			gpus[index] = &all[index]
+		}
+	}
+	return gpus, nil
+}
+
+// gpuCards maps the card numbers of the GPUs to their miner GPU index.
+func gpuCards(gpus map[int]*pciGpu) map[int]int {
+	cards := map[int]int{}
+	for index, g := range gpus {
+		cards[g.card] = index
+	}
+	return cards
+}
+
+type AMDGpuService struct {
+	sh ShellService
+}
+
+// NewAMDGpuService returns a GpuService for AMD GPUs, which are controlled through sysfs. Cards are matched to the
+// miner's GPU indices by PCI bus id, so rigs with an integrated GPU or mixed vendors are addressed correctly.
+func NewAMDGpuService(sh ShellService) GpuService {
+	return &AMDGpuService{sh: sh}
+}
+
+// amdWrite writes value to the given attribute of every hwmon device belonging to the card of the GPU.
+func (a *AMDGpuService) amdWrite(gpu int, attr string, value int) error {
+	gpus, err := vendorGpus(a.sh, amdVendorID)
+	if err != nil {
+		return err
+	}
+	g, ok := gpus[gpu]
+	if !ok {
+		return fmt.Errorf("GPU %d is not an AMD GPU", gpu)
+	}
+	hwmon := fmt.Sprintf(amdHwmonPath, g.card)
+	_, err = a.sh.Run(fmt.Sprintf("for d in %s; do echo %d | sudo -n tee $d/%s > /dev/null || exit 1; done", hwmon, value, attr))
+	return err
+}
+
+func (a *AMDGpuService) SetFanPercent(gpu int, percent float64) error {
+	// pwm1_enable 1 is manual control, pwm1 takes a value between 0-255
+	if err := a.amdWrite(gpu, "pwm1_enable", 1); err != nil {
+		return err
+	}
+	return a.amdWrite(gpu, "pwm1", int(math.Ceil(math.Min(percent, 100)*255/100)))
+}
+
+func (a *AMDGpuService) ResetFan(gpu int) error {
+	// pwm1_enable 2 hands fan control back to the driver
+	return a.amdWrite(gpu, "pwm1_enable", 2)
+}
+
+func (a *AMDGpuService) SetPowerLimit(gpu int, watts float64) error {
+	// power1_cap is in microwatts
+	return a.amdWrite(gpu, "power1_cap", int(watts*1000000))
+}
+
+func (a *AMDGpuService) SetClockOffsets(gpu int, coreMHz, memoryMHz float64) error {
+	return fmt.Errorf("clock offsets are not supported on AMD GPUs, which only take absolute clocks")
+}
+
+func (a *AMDGpuService) ClockOffsets(gpu int) (float64, float64, error) {
+	return 0, 0, fmt.Errorf("clock offsets are not supported on AMD GPUs, which only take absolute clocks")
+}
+
+// hwmonAttr prints the attribute of the hwmon device $d, or "-" if it does not exist.
+func hwmonAttr(attr string) string {
+	return fmt.Sprintf(" $(cat $d/%s 2>/dev/null || echo -)", attr)
+}
+
+// pciAttr prints the first word of the PCI attribute of the card $c, or "-" if it does not exist.
+func pciAttr(attr string) string {
+	return fmt.Sprintf(` $([ -f $c/device/%s ] && awk '{print $1}' $c/device/%s || echo -)`, attr, attr)
+}
+
+// pcieMaxLink prints the max link width of the card $c and of the port it is plugged into, followed by their max
+// link speeds. The lower of the two is the best link the card and slot support, which is only informational as
+// neither can see a riser between them.
+var pcieMaxLink = pciAttr("max_link_width") + pciAttr("../max_link_width") + pciAttr("max_link_speed") +
+	pciAttr("../max_link_speed")
+
+// pcieGen converts a PCIe link speed in GT/s to its generation.
+func pcieGen(gts float64) float64 {
+	for gen, speed := range []float64{2.5, 5, 8, 16, 32, 64} {
+		if gts <= speed {
+			return float64(gen + 1)
+		}
+	}
+	return 0
+}
+
+// amdRasCount prints the count of the given error type ("ce" or "ue") from the memory controller RAS counters of
+// the card $c, or "-" if RAS is not supported.
+func amdRasCount(kind string) string {
+	return fmt.Sprintf(` $([ -f $c/device/ras/umc_err_count ] && awk '/^%s:/{v=$2} END{print v==""?"-":v}' `+
+		`$c/device/ras/umc_err_count || echo -)`, kind)
+}
+
+// amdBadPages prints the number of retired VRAM pages of the card $c, or "-" if RAS is not supported.
+const amdBadPages = ` $([ -f $c/device/ras/gpu_vram_bad_pages ] && wc -l < $c/device/ras/gpu_vram_bad_pages || echo -)`
+
+// amdProductName is only available on some cards, older cards report their names through lspci only.
+const amdProductName = ` $(cat $c/device/product_name 2>/dev/null || echo -)`
+
+func (a *AMDGpuService) Collect(stats *Statistics) error {
+	gpus, err := vendorGpus(a.sh, amdVendorID)
+	if err != nil {
+		return err
+	}
+	cards := gpuCards(gpus)
+	out, err := a.sh.Run(fmt.Sprintf(drmCards, amdProductName))
+	if err != nil {
+		return err
+	}
+	if err := parseGpuNames(out, "", func(card int, name string) {
+		if gpu, ok := cards[card]; ok {
+			stats.GpuModels = setStringAt(stats.GpuModels, gpu, name)
+		}
+	}); err != nil {
+		return err
+	}
+	// temp3 is the memory temperature, reported in millidegrees, power in microwatts
+	out, err = a.sh.Run(fmt.Sprintf(drmCards, hwmonAttr("temp3_input")+hwmonAttr("power1_average")+hwmonAttr("power1_cap")+
+		amdRasCount("ce")+amdRasCount("ue")+amdBadPages+pciAttr("current_link_width")+pciAttr("current_link_speed")+pcieMaxLink))
+	if err != nil {
+		return err
+	}
+	return parseGpuTable(out, "", func(card, column int, value float64) {
+		gpu, ok := cards[card]
+		if !ok {
+			return
+		}
+		switch column {
+		case 0:
+			stats.GpuMemoryTemperatures = setFloatAt(stats.GpuMemoryTemperatures, gpu, value/1000)
+		case 1:
+			stats.GpuPowers = setFloatAt(stats.GpuPowers, gpu, value/1000000)
+		case 2:
+			stats.GpuPowerLimits = setFloatAt(stats.GpuPowerLimits, gpu, value/1000000)
+		case 3, 4:
+			stats.GpuMemoryErrors = setFloatAt(stats.GpuMemoryErrors, gpu, floatAt(stats.GpuMemoryErrors, gpu)+value)
+		case 5:
+			stats.GpuRetiredPages = setFloatAt(stats.GpuRetiredPages, gpu, value)
+		case 6:
+			stats.GpuPcieLinkWidths = setFloatAt(stats.GpuPcieLinkWidths, gpu, value)
+		case 7:
+			stats.GpuPcieLinkGens = setFloatAt(stats.GpuPcieLinkGens, gpu, pcieGen(value))
+		case 8, 9:
+			stats.GpuPcieLinkMaxWidths = setMinFloatAt(stats.GpuPcieLinkMaxWidths, gpu, value)
+		case 10, 11:
+			stats.GpuPcieLinkMaxGens = setMinFloatAt(stats.GpuPcieLinkMaxGens, gpu, pcieGen(value))
+		}
+	})
+}
+
+type IntelGpuService struct {
+	sh ShellService
+}
+
+// NewIntelGpuService returns a GpuService for Intel Arc GPUs. Telemetry is read from sysfs and, when installed,
+// xpu-smi. Arc fans are not controllable from Linux.
+//
+// Rigs may mix Arc cards with Nvidia or AMD GPUs, so Arc cards are matched to the miner's GPU indices by PCI bus
+// id. Miners are expected to number GPUs of all vendors in PCI bus order, and only readings of Arc cards are
+// written to their position.
+func NewIntelGpuService(sh ShellService) GpuService {
+	return &IntelGpuService{sh: sh}
+}
+
+// gpus returns the Arc cards of the rig by their miner GPU index. The xpu-smi device id, which is numbered
+// independently of the DRM cards, is -1 when xpu-smi is not installed.
+func (i *IntelGpuService) gpus() (map[int]*pciGpu, error) {
+	gpus, err := vendorGpus(i.sh, intelVendorID)
+	if err != nil {
+		return nil, err
+	}
+	byBus := map[string]*pciGpu{}
+	for _, g := range gpus {
+		byBus[g.busID] = g
+	}
+
+	// field 1 is the device id and 6 the PCI BDF address, the dump starts with a header
+	out, err := i.sh.Run(fmt.Sprintf("if command -v %s > /dev/null; then %s discovery --dump 1,6 | tail -n +2; fi", xpuSmi, xpuSmi))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			continue
+		}
+		device, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xpu-smi device id from %s: %s", line, err)
+		}
+		if g, ok := byBus[strings.ToLower(strings.TrimSpace(fields[1]))]; ok {
+			g.device = device
+		}
+	}
+	return gpus, nil
+}
+
+func (i *IntelGpuService) SetFanPercent(gpu int, percent float64) error {
+	return fmt.Errorf("fan control is not supported on Intel GPUs")
+}
+
+func (i *IntelGpuService) ResetFan(gpu int) error {
+	return fmt.Errorf("fan control is not supported on Intel GPUs")
+}
+
+func (i *IntelGpuService) SetPowerLimit(gpu int, watts float64) error {
+	gpus, err := i.gpus()
+	if err != nil {
+		return err
+	}
+	g, ok := gpus[gpu]
+	if !ok {
+		return fmt.Errorf("GPU %d is not an Intel GPU", gpu)
+	}
+	if g.device < 0 {
+		return fmt.Errorf("GPU %d not found by %s, power limit requires %s", gpu, xpuSmi, xpuSmi)
+	}
+	_, err = i.sh.Run(fmt.Sprintf("sudo -n %s config -d %d -t 0 --powerlimit %0.0f", xpuSmi, g.device, watts))
+	return err
+}
+
+func (i *IntelGpuService) SetClockOffsets(gpu int, coreMHz, memoryMHz float64) error {
+	return fmt.Errorf("clock offsets are not supported on Intel GPUs")
+}
+
+func (i *IntelGpuService) ClockOffsets(gpu int) (float64, float64, error) {
+	return 0, 0, fmt.Errorf("clock offsets are not supported on Intel GPUs")
+}
+
+func (i *IntelGpuService) Collect(stats *Statistics) error {
+	gpus, err := i.gpus()
+	if err != nil {
+		return err
+	}
+	cards, devices := gpuCards(gpus), map[int]int{}
+	for index, g := range gpus {
+		if g.device >= 0 {
+			devices[g.device] = index
+		}
+	}
+
+	// temp2 is the package and temp3 the memory temperature in millidegrees, power1_max the power limit in microwatts
+	out, err := i.sh.Run(fmt.Sprintf(drmCards, hwmonAttr("temp2_input")+hwmonAttr("temp3_input")+hwmonAttr("power1_max")+
+		pciAttr("current_link_width")+pciAttr("current_link_speed")+pcieMaxLink))
+	if err != nil {
+		return err
+	}
+	if err := parseGpuTable(out, "", func(card, column int, value float64) {
+		gpu, ok := cards[card]
+		if !ok {
+			return
+		}
+		switch column {
+		case 0:
+			stats.GpuTemperatures = setFloatAt(stats.GpuTemperatures, gpu, value/1000)
+		case 1:
+			stats.GpuMemoryTemperatures = setFloatAt(stats.GpuMemoryTemperatures, gpu, value/1000)
+		case 2:
+			stats.GpuPowerLimits = setFloatAt(stats.GpuPowerLimits, gpu, value/1000000)
+		case 3:
+			stats.GpuPcieLinkWidths = setFloatAt(stats.GpuPcieLinkWidths, gpu, value)
+		case 4:
+			stats.GpuPcieLinkGens = setFloatAt(stats.GpuPcieLinkGens, gpu, pcieGen(value))
+		case 5, 6:
+			stats.GpuPcieLinkMaxWidths = setMinFloatAt(stats.GpuPcieLinkMaxWidths, gpu, value)
+		case 7, 8:
+			stats.GpuPcieLinkMaxGens = setMinFloatAt(stats.GpuPcieLinkMaxGens, gpu, pcieGen(value))
+		}
+	}); err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	// metric 1 is the GPU power, 3 the core and 4 the memory temperature. The dump is prefixed by a header and a
+	// timestamp column which are cut so each line starts with the device id.
+	out, err = i.sh.Run(fmt.Sprintf("%s dump -d -1 -m 1,3,4 -n 1 | tail -n +2 | cut -d, -f2-", xpuSmi))
+	if err != nil {
+		return err
+	}
+	return parseGpuTable(out, ",", func(device, column int, value float64) {
+		gpu, ok := devices[device]
+		if !ok {
+			return
+		}
+		switch column {
+		case 0:
+			stats.GpuPowers = setFloatAt(stats.GpuPowers, gpu, value)
+		case 1:
+			stats.GpuTemperatures = setFloatAt(stats.GpuTemperatures, gpu, value)
+		case 2:
+			stats.GpuMemoryTemperatures = setFloatAt(stats.GpuMemoryTemperatures, gpu, value)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package mining_monitor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HashRateDatabase holds the hashrate expected of a hardware model mining an algorithm at stock settings, keyed by
+// model then algorithm. Hashrates are in the units the miners report them: kH/s per GPU and GH/s per ASIC, except
+// for scrypt ASICs which report MH/s.
+type HashRateDatabase map[string]map[string]float64
+
+var defaultHashRates = HashRateDatabase{
+	// Nvidia GPUs
+	"GTX 1060":       {"ethash": 22000, "etchash": 22000},
+	"GTX 1070":       {"ethash": 30000, "etchash": 30000},
+	"GTX 1070 Ti":    {"ethash": 31000, "etchash": 31000},
+	"GTX 1080":       {"ethash": 35000, "etchash": 35000},
+	"GTX 1080 Ti":    {"ethash": 45000, "etchash": 45000},
+	"P104-100":       {"ethash": 38000, "etchash": 38000},
+	"RTX 2060":       {"ethash": 30000, "etchash": 30000},
+	"RTX 2060 SUPER": {"ethash": 40000, "etchash": 40000},
+	"RTX 2070":       {"ethash": 40000, "etchash": 40000},
+	"RTX 2070 SUPER": {"ethash": 42000, "etchash": 42000},
+	"RTX 2080":       {"ethash": 42000, "etchash": 42000},
+	"RTX 2080 Ti":    {"ethash": 56000, "etchash": 56000},
+	"RTX 3060 Ti":    {"ethash": 60000, "etchash": 60000},
+	"RTX 3070":       {"ethash": 61000, "etchash": 61000},
+	"RTX 3080":       {"ethash": 98000, "etchash": 98000},
+	"RTX 3090":       {"ethash": 120000, "etchash": 120000},
+	// AMD GPUs
+	"RX 470":     {"ethash": 26000, "etchash": 26000},
+	"RX 480":     {"ethash": 29000, "etchash": 29000},
+	"RX 570":     {"ethash": 28000, "etchash": 28000},
+	"RX 580":     {"ethash": 30000, "etchash": 30000},
+	"Vega 56":    {"ethash": 36000, "etchash": 36000},
+	"Vega 64":    {"ethash": 40000, "etchash": 40000},
+	"RX 5700 XT": {"ethash": 54000, "etchash": 54000},
+	"RX 6800":    {"ethash": 61000, "etchash": 61000},
+	// Antminer ASICs
+	"Antminer S9":       {"sha256": 13500},
+	"Antminer S9i":      {"sha256": 14000},
+	"Antminer S9j":      {"sha256": 14500},
+	"Antminer T9+":      {"sha256": 10500},
+	"Antminer S17 Pro":  {"sha256": 53000},
+	"Antminer S19":      {"sha256": 95000},
+	"Antminer S19 Pro":  {"sha256": 110000},
+	"Antminer S19j Pro": {"sha256": 100000},
+	"Antminer S19 XP":   {"sha256": 140000},
+	"Antminer L3+":      {"scrypt": 504},
+}
+
+// NewHashRateDatabase returns a copy of the built in expected hashrates, which can be overridden.
+func NewHashRateDatabase() HashRateDatabase {
+	db := HashRateDatabase{}
+	for model, algorithms := range defaultHashRates {
+		for algorithm, hashRate := range algorithms {
+			db.Set(model, algorithm, hashRate)
+		}
+	}
+	return db
+}
+
+// Set sets the hashrate expected of a model, replacing any model of the same normalized name.
+func (db HashRateDatabase) Set(model, algorithm string, hashRate float64) {
+	for name := range db {
+		if normalizeModel(name) == normalizeModel(model) {
+			model = name
+			break
+		}
+	}
+	if db[model] == nil {
+		db[model] = map[string]float64{}
+	}
+	db[model][strings.ToLower(algorithm)] = hashRate
+}
+
+// modelVendorWords are dropped from model names before comparing them, as drivers and firmwares differ in whether
+// they report them.
+var modelVendorWords = map[string]bool{
+	"nvidia":  true,
+	"geforce": true,
+	"amd":     true,
+	"radeon":  true,
+	"bitmain": true,
+	"series":  true,
+}
+
+// normalizeModel lower cases a model name, collapses its whitespace and drops vendor words, so that
+// "NVIDIA GeForce GTX 1070 Ti" and "GTX 1070 Ti" compare equal.
+func normalizeModel(model string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(model)) {
+		if !modelVendorWords[word] {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Expected returns the expected hashrate of the model whose normalized name equals the reported model. Variants
+// missing from the database, e.g. "RTX 3080 Ti", are unknown rather than taken for a listed model.
+func (db HashRateDatabase) Expected(model, algorithm string) (float64, bool) {
+	model = normalizeModel(model)
+	if model == "" {
+		return 0, false
+	}
+	for name, algorithms := range db {
+		if normalizeModel(name) != model {
+			continue
+		}
+		hashRate, ok := algorithms[strings.ToLower(algorithm)]
+		return hashRate, ok
+	}
+	return 0, false
+}
+
+// LoadOverrides reads model,algorithm,hashrate lines from a CSV file, replacing or adding to the expected
+// hashrates. Lines starting with # are ignored.
+func (db HashRateDatabase) LoadOverrides(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open hashrate overrides %s: %s", path, err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to read hashrate overrides %s: %s", path, err)
+	}
+	for _, record := range records {
+		hashRate, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return fmt.Errorf("invalid hashrate %s for %s in %s: %s", record[2], record[0], path, err)
+		}
+		db.Set(record[0], record[1], hashRate)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// NewHealthHandler serves the container probes of the monitor. /livez fails once a client monitoring loop has hung,
+// so the container gets restarted, and /readyz additionally fails while the monitor is stopped or shutting down.
+func NewHealthHandler(m *Monitor) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, m.Healthy())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, m.Ready())
+	})
+	return mux
+}
+
+func writeHealth(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "%s\n", err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,138 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	hostSectionSeparator = "---"
+
+	hostStatsCommand = "cat /proc/loadavg; echo " + hostSectionSeparator +
+		"; cat /proc/meminfo; echo " + hostSectionSeparator +
+		"; df -P -k -x tmpfs -x devtmpfs -x squashfs -x overlay; echo " + hostSectionSeparator +
+		"; cat /sys/class/thermal/thermal_zone*/temp 2>/dev/null; echo " + hostSectionSeparator +
+		"; cat /proc/net/dev"
+)
+
+type HostStats struct {
+	Load1  float64
+	Load5  float64
+	Load15 float64
+
+	MemTotalKB     float64
+	MemAvailableKB float64
+
+	// DiskUsedPercents is keyed by mount point
+	DiskUsedPercents map[string]float64
+	Temperatures     []float64
+
+	// NetErrors is the total of receive and transmit errors of all interfaces since boot
+	NetErrors float64
+}
+
+func (h HostStats) MemUsedPercent() float64 {
+	if h.MemTotalKB == 0 {
+		return 0
+	}
+	return 100 * (h.MemTotalKB - h.MemAvailableKB) / h.MemTotalKB
+}
+
+func (h HostStats) String() string {
+	return fmt.Sprintf("{Load: %0.2f %0.2f %0.2f, Memory: %0.2f%%, Disks: %v, Temperatures: %v, NetErrors: %0.0f}",
+		h.Load1, h.Load5, h.Load15, h.MemUsedPercent(), h.DiskUsedPercents, h.Temperatures, h.NetErrors)
+}
+
+// HostCollector collects load, memory, disk, temperature and network statistics of the machine the miner runs on.
+type HostCollector struct {
+	sh ShellService
+}
+
+func NewHostCollector(sh ShellService) Collector {
+	return &HostCollector{sh: sh}
+}
+
+func (h *HostCollector) Collect(stats *Statistics) error {
+	out, err := h.sh.Run(hostStatsCommand)
+	if err != nil {
+		return err
+	}
+	sections := strings.Split(out, hostSectionSeparator+"\n")
+	if len(sections) != 5 {
+		return fmt.Errorf("unexpected host stats output %s", out)
+	}
+	host := &HostStats{DiskUsedPercents: map[string]float64{}}
+
+	load := strings.Fields(sections[0])
+	if len(load) < 3 {
+		return fmt.Errorf("failed to parse load from %s", sections[0])
+	}
+	for i, dst := range []*float64{&host.Load1, &host.Load5, &host.Load15} {
+		if *dst, err = strconv.ParseFloat(load[i], 64); err != nil {
+			return fmt.Errorf("failed to parse load from %s: %s", sections[0], err)
+		}
+	}
+
+	for _, line := range strings.Split(sections[1], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		var dst *float64
+		switch fields[0] {
+		case "MemTotal:":
+			dst = &host.MemTotalKB
+		case "MemAvailable:":
+			dst = &host.MemAvailableKB
+		default:
+			continue
+		}
+		if *dst, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return fmt.Errorf("failed to parse memory from %s: %s", line, err)
+		}
+	}
+
+	// Filesystem 1024-blocks Used Available Capacity Mounted-on
+	for _, line := range strings.Split(sections[2], "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		used, err := strconv.ParseFloat(strings.TrimSuffix(fields[4], "%"), 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse disk usage from %s: %s", line, err)
+		}
+		host.DiskUsedPercents[fields[5]] = used
+	}
+
+	for _, line := range strings.Fields(sections[3]) {
+		temp, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse host temperature from %s: %s", line, err)
+		}
+		host.Temperatures = append(host.Temperatures, temp/1000)
+	}
+
+	// Inter-|   Receive                                                |  Transmit
+	//  face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs ...
+	for _, line := range strings.Split(sections[4], "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 11 {
+			continue
+		}
+		for _, i := range []int{2, 10} {
+			errs, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse network errors from %s: %s", line, err)
+			}
+			host.NetErrors += errs
+		}
+	}
+	stats.Host = host
+	return nil
+}
@@ -0,0 +1,83 @@
+package mining_monitor
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const httpTimeout = 30 * time.Second
+
+var digestParam = regexp.MustCompile(`(\w+)="?([^",]*)"?`)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestRequest sends an HTTP request authenticated with digest auth as used by the Antminer web interface. The
+// request is first sent without credentials to obtain the challenge.
+func digestRequest(client *http.Client, method, url, contentType string, body []byte, user, password string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return nil, fmt.Errorf("unsupported authentication challenge %q from %s", challenge, url)
+	}
+	params := map[string]string{}
+	for _, match := range digestParam.FindAllStringSubmatch(challenge[len("Digest "):], -1) {
+		params[match[1]] = match[2]
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	cnonce := hex.EncodeToString(nonce)
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	uri := req.URL.RequestURI()
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", user, params["realm"], password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", method, uri))
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=MD5`,
+		user, params["realm"], params["nonce"], uri)
+	if params["qop"] != "" {
+		response := md5Hex(fmt.Sprintf("%s:%s:00000001:%s:auth:%s", ha1, params["nonce"], cnonce, ha2))
+		auth += fmt.Sprintf(`, qop=auth, nc=00000001, cnonce="%s", response="%s"`, cnonce, response)
+	} else {
+		auth += fmt.Sprintf(`, response="%s"`, md5Hex(fmt.Sprintf("%s:%s:%s", ha1, params["nonce"], ha2)))
+	}
+	if params["opaque"] != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, params["opaque"])
+	}
+	req.Header.Set("Authorization", auth)
+	return client.Do(req)
+}
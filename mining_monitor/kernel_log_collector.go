@@ -0,0 +1,84 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultKernelErrorPattern matches the Xids which do not recover without a power cycle: 79 fallen off the bus,
+	// 48 double bit ECC error and 62/64 internal micro-controller and ECC row remapping failures. Application faults
+	// such as 13, 31 and 43 are left out as the miner recovers from them on its own.
+	DefaultKernelErrorPattern = `NVRM: Xid \(.*?\): (79|48|62|64)\b|fallen off the bus`
+
+	// dmesgCommand prints the boot id of the rig on the first line, followed by the kernel ring buffer
+	dmesgCommand = "cat /proc/sys/kernel/random/boot_id && (dmesg 2>/dev/null || sudo -n dmesg)"
+)
+
+var dmesgTimestamp = regexp.MustCompile(`^\[\s*(\d+\.\d+)\]`)
+
+// KernelLogCollector reads the kernel ring buffer of the rig and reports every line matching its pattern that has
+// not been reported before as a KernelError. Lines already in the ring buffer the first time it is read are skipped,
+// so restarting the monitor does not report errors which were handled before.
+type KernelLogCollector struct {
+	sh      ShellService
+	pattern *regexp.Regexp
+
+	bootID   string
+	lastSeen float64
+}
+
+func NewKernelLogCollector(sh ShellService, pattern string) (Collector, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kernel log pattern %s: %s", pattern, err)
+	}
+	return &KernelLogCollector{sh: sh, pattern: re, lastSeen: -1}, nil
+}
+
+func (k *KernelLogCollector) Collect(stats *Statistics) error {
+	out, err := k.sh.Run(dmesgCommand)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	bootID, lines := strings.TrimSpace(lines[0]), lines[1:]
+	switch {
+	case k.bootID == "":
+		// first read, everything logged so far happened before the monitor started
+		k.bootID = bootID
+		for _, line := range lines {
+			k.lastSeen = k.timestamp(line)
+		}
+		return nil
+	case bootID != k.bootID:
+		// the rig has been rebooted since we last looked, every line is from the new boot
+		k.bootID = bootID
+		k.lastSeen = -1
+	}
+	for _, line := range lines {
+		ts := k.timestamp(line)
+		if ts <= k.lastSeen {
+			continue
+		}
+		k.lastSeen = ts
+		if k.pattern.MatchString(line) {
+			stats.KernelErrors = append(stats.KernelErrors, line)
+		}
+	}
+	return nil
+}
+
+func (k *KernelLogCollector) timestamp(line string) float64 {
+	match := dmesgTimestamp.FindStringSubmatch(line)
+	if match == nil {
+		return k.lastSeen
+	}
+	ts, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return k.lastSeen
+	}
+	return ts
+}
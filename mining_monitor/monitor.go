@@ -2,6 +2,7 @@ package mining_monitor
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -9,11 +10,22 @@ import (
 
 type ClientMonitorConfig struct {
 	Thresholds                  []*Threshold
+	Actions                     []*Action
+	Collectors                  []Collector
+	Recorder                    *StatsRecorder
 	CheckFailsBeforeReboot      int
 	RebootFailsBeforePowerCycle int
 	RebootInterval              time.Duration
 	StatsInterval               time.Duration
 	StateInterval               time.Duration
+
+	// RebootSchedule reboots the client preventively, unless it has been running for less than RebootScheduleSkip.
+	RebootSchedule     *Schedule
+	RebootScheduleSkip time.Duration
+
+	// Clock is the time the client is monitored on, the intervals and the thresholds and collectors measuring time
+	// run on it. It is the wall clock unless set, e.g. to the replay time of a ReplayClient.
+	Clock Clock
 }
 
 func NewClientMonitorConfig(thresholds []*Threshold, checkFailsBeforeReboot, rebootFailsBeforePowerCycle int,
@@ -25,6 +37,7 @@ func NewClientMonitorConfig(thresholds []*Threshold, checkFailsBeforeReboot, reb
 		RebootInterval:              rebootInterval,
 		StatsInterval:               statsInterval,
 		StateInterval:               stateInterval,
+		Clock:                       NewWallClock(),
 	}
 }
 
@@ -33,13 +46,28 @@ type ClientMonitoring struct {
 	Config *ClientMonitorConfig
 }
 
+// log messages of successful remediations, which reports count
+const (
+	rebootedMessage    = "rebooted successfully"
+	powerCycledMessage = "power cycled successfully"
+)
+
+// loopGracePeriod is how long a client monitoring loop may spend on a single stats poll or remediation, on top of
+// its stats interval, before it is considered wedged.
+const loopGracePeriod = 2 * time.Minute
+
 type Monitor struct {
 	c            []ClientMonitoring
 	EventService *EventService
+	// Scheduler runs jobs such as reports while the monitor is running, if set
+	Scheduler *Scheduler
 
-	stop     chan bool
-	interval time.Duration
-	state    int
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	stop       chan bool
+	interval   time.Duration
+	state      int
+	heartbeats []time.Time
 }
 
 func NewMonitor(eventService *EventService) *Monitor {
@@ -49,53 +77,146 @@ func NewMonitor(eventService *EventService) *Monitor {
 	}
 }
 
+// AddClient monitors the client, running its thresholds and collectors on the clock of its config.
 func (m *Monitor) AddClient(c Client, config *ClientMonitorConfig) {
+	if config.Clock == nil {
+		config.Clock = NewWallClock()
+	}
+	for _, t := range config.Thresholds {
+		t.clock = config.Clock
+	}
+	for _, col := range config.Collectors {
+		if cc, ok := col.(clocked); ok {
+			cc.setClock(config.Clock)
+		}
+	}
 	m.c = append(m.c, ClientMonitoring{C: c, Config: config})
 }
 
 func (m *Monitor) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.state == RUNNING {
 		return fmt.Errorf("monitor already running")
 	}
 	m.stop = make(chan bool, len(m.c))
 	m.state = RUNNING
-	for _, c := range m.c {
+	m.heartbeats = make([]time.Time, len(m.c))
+	for i, c := range m.c {
+		m.heartbeats[i] = time.Now()
 		m.EventService.E <- NewLogEvent(c.C, "starting monitoring...")
-		go m.monitorClient(m.stop, c.C, c.Config)
+		m.wg.Add(1)
+		go m.monitorClient(m.stop, i, c.C, c.Config)
 	}
 	go m.EventService.Start()
+	if m.Scheduler != nil {
+		m.Scheduler.Start()
+	}
 	return nil
 }
 
+// Stop blocks until every client monitoring loop has finished any in-flight remediation and all their events have
+// been handled.
 func (m *Monitor) Stop() error {
+	m.mu.Lock()
 	if m.state == STOPPED {
+		m.mu.Unlock()
 		return fmt.Errorf("monitor already stopped")
 	}
+	m.state = STOPPED
 	for i := 0; i < len(m.c); i++ {
 		m.stop <- true
 	}
-	m.EventService.Stop()
-	m.state = STOPPED
 	close(m.stop)
+	m.mu.Unlock()
+
+	if m.Scheduler != nil {
+		m.Scheduler.Stop()
+	}
+	m.wg.Wait()
+	m.EventService.Stop()
 	return nil
 }
 
-func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorConfig) {
+// Ready returns an error unless the monitor is running and healthy.
+func (m *Monitor) Ready() error {
+	m.mu.Lock()
+	running := m.state == RUNNING
+	m.mu.Unlock()
+	if !running {
+		return fmt.Errorf("monitor is not running")
+	}
+	return m.Healthy()
+}
+
+// Healthy returns an error if any client monitoring loop or the event loop has stopped making progress while the
+// monitor is running.
+func (m *Monitor) Healthy() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state != RUNNING {
+		return nil
+	}
+	for i, c := range m.c {
+		if since := time.Since(m.heartbeats[i]); since > 2*c.Config.Clock.Wall(c.Config.StatsInterval)+loopGracePeriod {
+			return fmt.Errorf("[%s] monitoring loop has not made progress in %v", c.C.IP(), since)
+		}
+	}
+	return m.EventService.Healthy()
+}
+
+func (m *Monitor) heartbeat(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heartbeats[i] = time.Now()
+}
+
+func (m *Monitor) monitorClient(stop chan bool, i int, c Client, config *ClientMonitorConfig) {
+	defer m.wg.Done()
 	m.EventService.E <- NewLogEvent(c,
-		fmt.Sprintf("Monitor Starting\tThresholds: %s\tPowerCycle: %t\tReadOnly: %t\tCheckFailsBeforeReboot: %d\t RebootFailsBeforePowercycle: %d\tRebootInterval: %v\tStatsInterval: %v\tStateInterval: %v",
-			config.Thresholds, c.PowerCycleEnabled(), c.ReadOnly(), config.CheckFailsBeforeReboot, config.RebootFailsBeforePowerCycle, config.RebootInterval, config.StatsInterval, config.StateInterval),
+		fmt.Sprintf("Monitor Starting\tThresholds: %s\tActions: %s\tPowerCycle: %t\tReadOnly: %t\tCheckFailsBeforeReboot: %d\t RebootFailsBeforePowercycle: %d\tRebootInterval: %v\tStatsInterval: %v\tStateInterval: %v",
+			config.Thresholds, config.Actions, c.PowerCycleEnabled(), c.ReadOnly(), config.CheckFailsBeforeReboot, config.RebootFailsBeforePowerCycle, config.RebootInterval, config.StatsInterval, config.StateInterval),
 	)
-	stateTicker := time.NewTicker(config.StateInterval)
-	statsTicker := time.NewTicker(config.StatsInterval)
+	clock := config.Clock
+	stateTicker := time.NewTicker(clock.Wall(config.StateInterval))
+	statsTicker := time.NewTicker(clock.Wall(config.StatsInterval))
 
 	failedReboots := 0
 	failedChecks := 0
-	lastReboot := time.Now().Add(-config.RebootInterval)
+	lastReboot := clock.Now().Add(-config.RebootInterval)
 	var errors []error
 	reset := false
 	state := RUNNING
 
+	var scheduledReboots <-chan time.Time
+	var scheduledRebootTimer *time.Timer
+	var lastStats *Statistics
+	scheduledRebootDue := false
+	// criticalErrors are the errors last emailed for each critical threshold which is still exceeded
+	criticalErrors := map[string]string{}
+	var verifyScheduledReboot time.Time
+	scheduleReboot := func() {
+		now := clock.Now()
+		next := config.RebootSchedule.Next(now)
+		if next.IsZero() {
+			m.EventService.E <- NewErrorEvent(c, fmt.Errorf("reboot schedule %s never matches", config.RebootSchedule))
+			return
+		}
+		glog.V(1).Infof("[%s] next scheduled reboot at %v", c.IP(), next)
+		scheduledRebootTimer = time.NewTimer(clock.Wall(next.Sub(now)))
+		scheduledReboots = scheduledRebootTimer.C
+	}
+	if config.RebootSchedule != nil {
+		scheduleReboot()
+		defer func() {
+			if scheduledRebootTimer != nil {
+				scheduledRebootTimer.Stop()
+			}
+		}()
+	}
+
 	for {
+		m.heartbeat(i)
 		select {
 		case <-stateTicker.C:
 			glog.V(1).Infof("State: {failedReboots: %d, failedChecks: %d}", failedReboots, failedChecks)
@@ -105,12 +226,17 @@ func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorC
 				errors = []error{}
 				reset = false
 			}
+			if !verifyScheduledReboot.IsZero() && clock.Now().Sub(verifyScheduledReboot) > config.RebootInterval {
+				m.EventService.E <- NewEmailEvent(c, "Scheduled reboot NOT verified",
+					fmt.Sprintf("Client did not return healthy within %v of its scheduled reboot", config.RebootInterval))
+				verifyScheduledReboot = time.Time{}
+			}
 			if c.PowerCycleEnabled() && failedReboots > config.RebootFailsBeforePowerCycle {
 				if state != POWERCYCLING {
 					m.EventService.E <- NewLogEvent(c, "transitioning to POWERCYCLING state...")
 				}
 				state = POWERCYCLING
-			} else if failedChecks > config.CheckFailsBeforeReboot && time.Now().Sub(lastReboot) > config.RebootInterval {
+			} else if (failedChecks > config.CheckFailsBeforeReboot || scheduledRebootDue) && clock.Now().Sub(lastReboot) > config.RebootInterval {
 				if state != REBOOTING {
 					m.EventService.E <- NewLogEvent(c, "transitioning to REBOOTING state...")
 				}
@@ -121,24 +247,77 @@ func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorC
 				}
 				state = RUNNING
 			}
+		case <-scheduledReboots:
+			scheduleReboot()
+			if state != RUNNING {
+				m.EventService.E <- NewLogEvent(c, "skipping scheduled reboot, client is already being remediated")
+			} else if lastStats != nil && time.Duration(lastStats.RunningTime)*time.Minute < config.RebootScheduleSkip {
+				m.EventService.E <- NewLogEvent(c, fmt.Sprintf("skipping scheduled reboot, client restarted %d minutes ago", lastStats.RunningTime))
+			} else {
+				m.EventService.E <- NewLogEvent(c, "scheduled preventive reboot due")
+				scheduledRebootDue = true
+			}
 		case <-statsTicker.C:
 			switch state {
 			case RUNNING:
 				stats, err := c.Stats()
+				if err == nil {
+					lastStats = stats
+					for _, col := range config.Collectors {
+						if err := col.Collect(stats); err != nil {
+							m.EventService.E <- NewErrorEvent(c, fmt.Errorf("failed to collect stats: %s", err))
+						}
+					}
+				}
+				if config.Recorder != nil {
+					if err := config.Recorder.Record(c, stats, err); err != nil {
+						m.EventService.E <- NewErrorEvent(c, err)
+					}
+				}
 				if err != nil {
 					m.EventService.E <- NewErrorEvent(c, err)
 				} else {
+					for _, a := range config.Actions {
+						changes, err := a.Run(c, stats)
+						for _, change := range changes {
+							m.EventService.E <- NewLogEvent(c, fmt.Sprintf("%s: %s", a.Name, change))
+						}
+						if err != nil {
+							m.EventService.E <- NewErrorEvent(c, fmt.Errorf("%s action failed: %s", a.Name, err))
+						}
+					}
 					var rebootErrors []error
 					var emailErrors []error
+					powerCycle := false
+					immediateReboot := false
 					for _, t := range config.Thresholds {
 						thresholdErrors := t.Check(stats)
+						if t.Critical && len(thresholdErrors) == 0 {
+							delete(criticalErrors, t.Name)
+						}
 						if thresholdErrors != nil && len(thresholdErrors) > 0 {
-							if t.SendEmail {
+							if t.SendEmail && t.Critical {
+								for _, err := range thresholdErrors {
+									m.EventService.E <- NewErrorEvent(c, err)
+								}
+								// critical thresholds stay exceeded until someone intervenes, so they are only
+								// emailed again when their errors change
+								if message := fmtErrors(thresholdErrors); criticalErrors[t.Name] != message {
+									criticalErrors[t.Name] = message
+									m.EventService.E <- NewEmailEvent(c, fmt.Sprintf("CRITICAL: %s threshold exceeded!", t.Name), message)
+								}
+							} else if t.SendEmail {
 								emailErrors = append(emailErrors, thresholdErrors...)
 							}
-							if t.CauseReboot {
+							if t.CauseReboot || t.CausePowerCycle {
 								rebootErrors = append(rebootErrors, thresholdErrors...)
 							}
+							if t.CausePowerCycle {
+								powerCycle = true
+							}
+							if t.CauseImmediateReboot {
+								immediateReboot = true
+							}
 						}
 					}
 					if len(rebootErrors) > 0 {
@@ -148,6 +327,14 @@ func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorC
 						}
 						failedChecks++
 					}
+					if powerCycle {
+						m.EventService.E <- NewLogEvent(c, "critical threshold exceeded, skipping straight to power cycle")
+						failedChecks = config.CheckFailsBeforeReboot + 1
+						failedReboots = config.RebootFailsBeforePowerCycle + 1
+					} else if immediateReboot {
+						m.EventService.E <- NewLogEvent(c, "critical threshold exceeded, skipping straight to reboot")
+						failedChecks = config.CheckFailsBeforeReboot + 1
+					}
 					if len(emailErrors) > 0 {
 						body := ""
 						for _, err := range emailErrors {
@@ -158,6 +345,10 @@ func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorC
 					}
 					if len(rebootErrors) == 0 && len(emailErrors) == 0 {
 						reset = true
+						if !verifyScheduledReboot.IsZero() && float64(stats.RunningTime) <= clock.Now().Sub(verifyScheduledReboot).Minutes() {
+							m.EventService.E <- NewLogEvent(c, "scheduled reboot verified, client is healthy")
+							verifyScheduledReboot = time.Time{}
+						}
 					}
 				}
 			case REBOOTING:
@@ -167,10 +358,20 @@ func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorC
 					m.EventService.E <- NewEmailEvent(c, "FAILED to Reboot", fmt.Sprintf("Client was unable to be restarted due to error: %s", err))
 					failedReboots++
 				} else {
-					m.EventService.E <- NewLogEvent(c, "rebooted successfully")
-					m.EventService.E <- NewEmailEvent(c, "SUCCESSFULLY rebooted", fmt.Sprintf("Client was restarted due to events: %s", fmtErrors(errors)))
+					m.EventService.E <- NewLogEvent(c, rebootedMessage)
+					if scheduledRebootDue {
+						body := fmt.Sprintf("Client was restarted by its reboot schedule %s", config.RebootSchedule)
+						if len(errors) > 0 {
+							body += fmt.Sprintf(", events: %s", fmtErrors(errors))
+						}
+						m.EventService.E <- NewEmailEvent(c, "SUCCESSFULLY rebooted", body)
+						scheduledRebootDue = false
+						verifyScheduledReboot = clock.Now()
+					} else {
+						m.EventService.E <- NewEmailEvent(c, "SUCCESSFULLY rebooted", fmt.Sprintf("Client was restarted due to events: %s", fmtErrors(errors)))
+					}
 					reset = true
-					lastReboot = time.Now()
+					lastReboot = clock.Now()
 				}
 			case POWERCYCLING:
 				m.EventService.E <- NewLogEvent(c, fmt.Sprintf("Attempting to power cycle..."))
@@ -178,13 +379,29 @@ func (m *Monitor) monitorClient(stop chan bool, c Client, config *ClientMonitorC
 					m.EventService.E <- NewErrorEvent(c, err)
 					m.EventService.E <- NewEmailEvent(c, "FAILED to Power Cycle", fmt.Sprintf("Client was unable to power cycle due to error: %s", err))
 				} else {
-					m.EventService.E <- NewLogEvent(c, "power cycled successfully")
+					m.EventService.E <- NewLogEvent(c, powerCycledMessage)
 					m.EventService.E <- NewEmailEvent(c, "SUCCESSFULLY Power Cycled", fmt.Sprintf("Client was power cycled due to errors: %s", fmtErrors(errors)))
+					if scheduledRebootDue {
+						scheduledRebootDue = false
+						verifyScheduledReboot = clock.Now()
+					}
 					reset = true
-					lastReboot = time.Now()
+					lastReboot = clock.Now()
 				}
 			}
 		case <-stop:
+			for _, a := range config.Actions {
+				if a.Restore == nil {
+					continue
+				}
+				changes, err := a.Restore(c)
+				for _, change := range changes {
+					m.EventService.E <- NewLogEvent(c, fmt.Sprintf("%s: %s", a.Name, change))
+				}
+				if err != nil {
+					m.EventService.E <- NewErrorEvent(c, fmt.Errorf("%s action failed to restore: %s", a.Name, err))
+				}
+			}
 			m.EventService.E <- NewLogEvent(c, "Client monitoring stopped")
 			return
 		}
@@ -0,0 +1,589 @@
+package mining_monitor
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Plugins are executables serving a Client, PowerService or EventSink over net/rpc, so they can be developed and
+// shipped separately from the monitor. The monitor starts the plugin with the handshake cookie and a random token in
+// its environment, and the plugin replies with a handshake line on stdout:
+//
+//	<protocol version>|<kind>|<address>
+//
+// after which the monitor connects to the address. The address is a loopback port other local users can connect to,
+// so every call carries the token and the plugin refuses calls without it. The plugin exits when its stdin is
+// closed, which happens when the monitor closes the plugin or exits.
+const (
+	pluginCookieKey       = "MINING_MONITOR_PLUGIN"
+	pluginCookieValue     = "c5f1a2d8e0b34c6b9e7f"
+	pluginTokenKey        = "MINING_MONITOR_PLUGIN_TOKEN"
+	pluginProtocolVersion = 2
+	pluginStartTimeout    = 10 * time.Second
+	// pluginCallTimeout bounds every call, a plugin which does not answer in time is killed and restarted on its
+	// next call
+	pluginCallTimeout = time.Minute
+
+	PluginKindClient = "client"
+	PluginKindPower  = "power"
+	PluginKindSink   = "sink"
+)
+
+// ServePlugin serves a Client, PowerService or EventSink to the monitor which started this process. It returns once
+// the monitor closes the plugin, or with an error if the process was not started by the monitor.
+func ServePlugin(impl interface{}) error {
+	if os.Getenv(pluginCookieKey) != pluginCookieValue {
+		return fmt.Errorf("this is a mining monitor plugin, it must be started by the mining monitor")
+	}
+	token := pluginToken(os.Getenv(pluginTokenKey))
+	if token == "" {
+		return fmt.Errorf("no %s set by the mining monitor", pluginTokenKey)
+	}
+	server := rpc.NewServer()
+	var kind string
+	var err error
+	switch impl := impl.(type) {
+	case Client:
+		kind, err = PluginKindClient, server.RegisterName("Plugin", &clientPluginServer{pluginToken: token, c: impl})
+	case PowerService:
+		kind, err = PluginKindPower, server.RegisterName("Plugin", &powerPluginServer{pluginToken: token, ps: impl})
+	case EventSink:
+		kind, err = PluginKindSink, server.RegisterName("Plugin", &sinkPluginServer{pluginToken: token, sink: impl})
+	default:
+		return fmt.Errorf("plugins must implement Client, PowerService or EventSink, got %T", impl)
+	}
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen for the monitor: %s", err)
+	}
+	defer l.Close()
+	fmt.Printf("%d|%s|%s\n", pluginProtocolVersion, kind, l.Addr())
+	go func() {
+		io.Copy(ioutil.Discard, os.Stdin)
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			// the listener is closed once the monitor closes stdin
+			return nil
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// PluginArgs are the arguments of every plugin call. Event is only set for calls to sink plugins.
+type PluginArgs struct {
+	Token string
+	Event PluginEvent
+}
+
+// pluginToken is the token a plugin was started with, which every call must carry.
+type pluginToken string
+
+// newPluginToken returns a random token for a plugin start.
+func newPluginToken() (pluginToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate plugin token: %s", err)
+	}
+	return pluginToken(hex.EncodeToString(b)), nil
+}
+
+func (t pluginToken) check(args PluginArgs) error {
+	if subtle.ConstantTimeCompare([]byte(args.Token), []byte(t)) != 1 {
+		return fmt.Errorf("invalid plugin token")
+	}
+	return nil
+}
+
+type clientPluginServer struct {
+	pluginToken
+	c Client
+}
+
+func (s *clientPluginServer) IP(args PluginArgs, reply *string) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	*reply = s.c.IP()
+	return nil
+}
+
+func (s *clientPluginServer) Stats(args PluginArgs, reply *Statistics) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	stats, err := s.c.Stats()
+	if err != nil {
+		return err
+	}
+	*reply = *stats
+	return nil
+}
+
+func (s *clientPluginServer) Reboot(args PluginArgs, _ *int) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	return s.c.Reboot()
+}
+
+func (s *clientPluginServer) Restart(args PluginArgs, _ *int) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	return s.c.Restart()
+}
+
+func (s *clientPluginServer) PowerCycleEnabled(args PluginArgs, reply *bool) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	*reply = s.c.PowerCycleEnabled()
+	return nil
+}
+
+func (s *clientPluginServer) PowerCycle(args PluginArgs, _ *int) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	return s.c.PowerCycle()
+}
+
+type powerPluginServer struct {
+	pluginToken
+	ps PowerService
+}
+
+func (s *powerPluginServer) Off(args PluginArgs, _ *int) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	return s.ps.Off()
+}
+
+func (s *powerPluginServer) On(args PluginArgs, _ *int) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	return s.ps.On()
+}
+
+func (s *powerPluginServer) State(args PluginArgs, reply *PowerState) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	state, err := s.ps.State()
+	if err != nil {
+		return err
+	}
+	*reply = *state
+	return nil
+}
+
+// PluginEvent is an Event as sent to sink plugins, whose clients and errors can not be sent over RPC.
+type PluginEvent struct {
+	Type        int
+	Client      string
+	Subject     string
+	Message     string
+	Error       string
+	HTML        string
+	Attachments []Attachment
+}
+
+// pluginEventClient stands in for the client of events received by sink plugins, which only know its IP.
+type pluginEventClient struct {
+	ip string
+}
+
+func (c pluginEventClient) IP() string {
+	return c.ip
+}
+
+func (c pluginEventClient) Stats() (*Statistics, error) {
+	return nil, fmt.Errorf("not available to plugins")
+}
+
+func (c pluginEventClient) Reboot() error {
+	return fmt.Errorf("not available to plugins")
+}
+
+func (c pluginEventClient) Restart() error {
+	return fmt.Errorf("not available to plugins")
+}
+
+func (c pluginEventClient) PowerCycleEnabled() bool {
+	return false
+}
+
+func (c pluginEventClient) PowerCycle() error {
+	return fmt.Errorf("not available to plugins")
+}
+
+func (c pluginEventClient) SetReadOnly(readOnly, failOnWrites bool) {}
+
+func (c pluginEventClient) ReadOnly() bool {
+	return true
+}
+
+type sinkPluginServer struct {
+	pluginToken
+	sink EventSink
+}
+
+func (s *sinkPluginServer) Handle(args PluginArgs, _ *int) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	e := args.Event
+	event := Event{Type: e.Type, Client: pluginEventClient{ip: e.Client}, Subject: e.Subject, Message: e.Message,
+		HTML: e.HTML, Attachments: e.Attachments}
+	if e.Error != "" {
+		event.Error = fmt.Errorf("%s", e.Error)
+	}
+	return s.sink.Handle(event)
+}
+
+// Plugin is a plugin process started by the monitor. A plugin which has exited is restarted on its next call.
+type Plugin struct {
+	path string
+	args []string
+	kind string
+
+	mu    sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	rpc   *rpc.Client
+	token pluginToken
+}
+
+func startPlugin(kind, path string, args ...string) (*Plugin, error) {
+	p := &Plugin{path: path, args: args, kind: kind}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// start runs the plugin and connects to it, p.mu must be held or p not yet shared.
+func (p *Plugin) start() error {
+	token, err := newPluginToken()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(p.path, p.args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", pluginCookieKey, pluginCookieValue),
+		fmt.Sprintf("%s=%s", pluginTokenKey, token))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start plugin %s: %s", p.path, err)
+	}
+	go p.log(stderr)
+
+	handshake := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		if scanner.Scan() {
+			handshake <- scanner.Text()
+		}
+		close(handshake)
+		for scanner.Scan() {
+			glog.Infof("[plugin %s] %s", p.path, scanner.Text())
+		}
+	}()
+	var addr string
+	select {
+	case line, ok := <-handshake:
+		if !ok {
+			err = fmt.Errorf("exited without a handshake, is it a mining monitor plugin?")
+		} else if addr, err = p.parseHandshake(line); err == nil {
+			p.rpc, err = rpc.Dial("tcp", addr)
+		}
+	case <-time.After(pluginStartTimeout):
+		err = fmt.Errorf("no handshake received within %v", pluginStartTimeout)
+	}
+	if err != nil {
+		stdin.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("failed to start plugin %s: %s", p.path, err)
+	}
+	p.cmd = cmd
+	p.stdin = stdin
+	p.token = token
+	return nil
+}
+
+func (p *Plugin) parseHandshake(line string) (string, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid handshake %s", line)
+	}
+	if version, err := strconv.Atoi(parts[0]); err != nil || version != pluginProtocolVersion {
+		return "", fmt.Errorf("unsupported protocol version %s, expected %d", parts[0], pluginProtocolVersion)
+	}
+	if parts[1] != p.kind {
+		return "", fmt.Errorf("plugin is a %s plugin, expected a %s plugin", parts[1], p.kind)
+	}
+	return parts[2], nil
+}
+
+func (p *Plugin) log(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		glog.Infof("[plugin %s] %s", p.path, scanner.Text())
+	}
+}
+
+// call calls a method of the plugin, restarting the plugin if it has exited.
+func (p *Plugin) call(method string, reply interface{}) error {
+	return p.callWithArgs(method, PluginArgs{}, reply)
+}
+
+func (p *Plugin) callWithArgs(method string, args PluginArgs, reply interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rpc == nil {
+		if err := p.start(); err != nil {
+			return err
+		}
+	}
+	err := p.do(method, args, reply)
+	switch err {
+	case rpc.ErrShutdown:
+		// the plugin exited before the call was sent, so it is safe to retry
+		glog.Infof("plugin %s exited, restarting it", p.path)
+		p.stop()
+		if err := p.start(); err != nil {
+			return err
+		}
+		err = p.do(method, args, reply)
+	case io.ErrUnexpectedEOF:
+		// the plugin exited during the call, which may have had an effect, so it is restarted on the next call
+		p.stop()
+	}
+	return err
+}
+
+// do makes a single call with the token of the running plugin, killing the plugin if it does not answer within
+// pluginCallTimeout so it is restarted on the next call, p.mu must be held.
+func (p *Plugin) do(method string, args PluginArgs, reply interface{}) error {
+	args.Token = string(p.token)
+	call := p.rpc.Go("Plugin."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(pluginCallTimeout):
+		glog.Infof("plugin %s did not answer %s within %v, stopping it", p.path, method, pluginCallTimeout)
+		p.stop()
+		// the call fails once the connection is closed, after which reply is no longer written to
+		<-call.Done
+		return fmt.Errorf("plugin %s did not answer %s within %v", p.path, method, pluginCallTimeout)
+	}
+}
+
+// stop closes the plugin, killing it if it does not exit, p.mu must be held.
+func (p *Plugin) stop() {
+	p.rpc.Close()
+	p.stdin.Close()
+	exited := make(chan bool)
+	go func() {
+		p.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(pluginStartTimeout):
+		p.cmd.Process.Kill()
+		<-exited
+	}
+	p.rpc = nil
+}
+
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rpc != nil {
+		p.stop()
+	}
+	return nil
+}
+
+// PluginClient is a Client served by a plugin. Read only mode is enforced by the monitor rather than the plugin.
+type PluginClient struct {
+	p            *Plugin
+	ip           string
+	readOnly     bool
+	failOnWrites bool
+}
+
+// NewPluginClient starts the client plugin at path with the args.
+func NewPluginClient(path string, args ...string) (Client, error) {
+	p, err := startPlugin(PluginKindClient, path, args...)
+	if err != nil {
+		return nil, err
+	}
+	c := &PluginClient{p: p}
+	if err := p.call("IP", &c.ip); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to get IP of plugin %s: %s", path, err)
+	}
+	return c, nil
+}
+
+func (c *PluginClient) Stats() (*Statistics, error) {
+	stats := &Statistics{}
+	if err := c.p.call("Stats", stats); err != nil {
+		return nil, err
+	}
+	glog.V(3).Infof("[%s] Stats: %+v", c.IP(), stats)
+	return stats, nil
+}
+
+func (c *PluginClient) Reboot() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	return c.p.call("Reboot", new(int))
+}
+
+func (c *PluginClient) Restart() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	return c.p.call("Restart", new(int))
+}
+
+func (c *PluginClient) PowerCycleEnabled() bool {
+	var enabled bool
+	if err := c.p.call("PowerCycleEnabled", &enabled); err != nil {
+		glog.Infof("[%s] failed to check if power cycle is enabled: %s", c.IP(), err)
+		return false
+	}
+	return enabled
+}
+
+func (c *PluginClient) PowerCycle() error {
+	if c.readOnly {
+		if c.failOnWrites {
+			return fmt.Errorf("client is read only")
+		}
+		return nil
+	}
+	return c.p.call("PowerCycle", new(int))
+}
+
+func (c *PluginClient) SetReadOnly(readOnly, failOnWrites bool) {
+	c.readOnly = readOnly
+	c.failOnWrites = failOnWrites
+}
+
+func (c *PluginClient) ReadOnly() bool {
+	return c.readOnly
+}
+
+func (c *PluginClient) IP() string {
+	return c.ip
+}
+
+func (c *PluginClient) Close() error {
+	return c.p.Close()
+}
+
+// PluginPowerService is a PowerService served by a plugin.
+type PluginPowerService struct {
+	p *Plugin
+}
+
+// NewPluginPowerService starts the power plugin at path with the args.
+func NewPluginPowerService(path string, args ...string) (PowerService, error) {
+	p, err := startPlugin(PluginKindPower, path, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginPowerService{p: p}, nil
+}
+
+func (s *PluginPowerService) Off() error {
+	return s.p.call("Off", new(int))
+}
+
+func (s *PluginPowerService) On() error {
+	return s.p.call("On", new(int))
+}
+
+func (s *PluginPowerService) State() (*PowerState, error) {
+	state := &PowerState{}
+	if err := s.p.call("State", state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *PluginPowerService) Close() error {
+	return s.p.Close()
+}
+
+// PluginEventSink is an EventSink served by a plugin.
+type PluginEventSink struct {
+	p *Plugin
+}
+
+// NewPluginEventSink starts the sink plugin at path with the args.
+func NewPluginEventSink(path string, args ...string) (EventSink, error) {
+	p, err := startPlugin(PluginKindSink, path, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginEventSink{p: p}, nil
+}
+
+func (s *PluginEventSink) Handle(e Event) error {
+	event := PluginEvent{Type: e.Type, Client: e.Client.IP(), Subject: e.Subject, Message: e.Message, HTML: e.HTML,
+		Attachments: e.Attachments}
+	if e.Error != nil {
+		event.Error = e.Error.Error()
+	}
+	return s.p.callWithArgs("Handle", PluginArgs{Event: event}, new(int))
+}
+
+func (s *PluginEventSink) Close() error {
+	return s.p.Close()
+}
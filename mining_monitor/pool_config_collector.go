@@ -0,0 +1,54 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// PoolConfigReader is implemented by clients which can read the pools configured on the miner.
+type PoolConfigReader interface {
+	PoolConfigs() ([]PoolConfig, error)
+}
+
+// PoolConfigCollector reads the pools and wallets configured on the miner once per interval, so they can be checked
+// against the expected ones.
+type PoolConfigCollector struct {
+	r        PoolConfigReader
+	interval time.Duration
+	clock    Clock
+
+	pools    []PoolConfig
+	lastRead time.Time
+}
+
+func NewPoolConfigCollector(c Client, interval time.Duration) (Collector, error) {
+	r, ok := c.(PoolConfigReader)
+	if !ok {
+		return nil, fmt.Errorf("reading the pool configuration is not supported by %s", c.IP())
+	}
+	return &PoolConfigCollector{r: r, interval: interval, clock: NewWallClock()}, nil
+}
+
+func (p *PoolConfigCollector) setClock(clock Clock) {
+	p.clock = clock
+}
+
+// Collect checks the last pools read when they can't be read again. Until they are first read the error is set on
+// the stats, so the pool and wallet checks fail rather than pass with no pools.
+func (p *PoolConfigCollector) Collect(stats *Statistics) error {
+	if p.lastRead.IsZero() || p.clock.Now().Sub(p.lastRead) > p.interval {
+		pools, err := p.r.PoolConfigs()
+		if err != nil {
+			if p.lastRead.IsZero() {
+				stats.PoolsError = err.Error()
+				return err
+			}
+			stats.Pools = p.pools
+			return fmt.Errorf("failed to read pools, checking the pools read at %v: %s", p.lastRead, err)
+		}
+		p.pools = pools
+		p.lastRead = p.clock.Now()
+	}
+	stats.Pools = p.pools
+	return nil
+}
@@ -3,6 +3,7 @@ package mining_monitor
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/oliveagle/jsonpath"
 	"github.com/sausheong/hs1xxplug"
@@ -28,6 +29,26 @@ type PowerService interface {
 	State() (*PowerState, error)
 }
 
+// cyclePower turns the power off if it is on, waits for the rig to drain and turns it back on.
+func cyclePower(ps PowerService) error {
+	state, err := ps.State()
+	if err != nil {
+		return err
+	}
+
+	if state.On {
+		if err := ps.Off(); err != nil {
+			return fmt.Errorf("failed to turn power off: %s", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+
+	if err := ps.On(); err != nil {
+		return fmt.Errorf("failed to turn power on: %s", err)
+	}
+	return nil
+}
+
 type HS110PowerService struct {
 	IP string
 
@@ -0,0 +1,412 @@
+package mining_monitor
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report summarises the operation of the rigs in a stats recording between From and To.
+type Report struct {
+	From     time.Time
+	To       time.Time
+	Currency string
+	Rigs     []*RigReport
+	// the fleet revenue, power cost and profit are the totals of the rigs with revenue
+	HasRevenue     bool
+	FleetRevenue   float64
+	FleetPowerCost float64
+	FleetProfit    float64
+	// Events are the remediation and critical emails sent about the rigs, see remediationSubjects
+	Events []EventRecord
+}
+
+type RigReport struct {
+	Name        string
+	Polls       int
+	FailedPolls int
+	// Uptime is the percentage of the report the rig was mining, see uptime
+	Uptime             float64
+	Reboots            int
+	PowerCycles        int
+	FailedRemediations int
+	Algorithms         []*AlgorithmTrend
+
+	// revenue and power costs are estimated from the average per day over the report
+	HasRevenue      bool
+	RevenuePerDay   float64
+	PowerCostPerDay float64
+	Revenue         float64
+	PowerCost       float64
+	Profit          float64
+
+	algorithms       map[string]*AlgorithmTrend
+	polls            []StatsRecord
+	revenueTotal     float64
+	revenueSamples   int
+	powerCostTotal   float64
+	powerCostSamples int
+}
+
+// AlgorithmTrend is the daily average hashrate of an algorithm, in the unit the miner reports.
+type AlgorithmTrend struct {
+	Algorithm string
+	Average   float64
+	Min       float64
+	Max       float64
+	Days      []DayHashRate
+
+	total   float64
+	samples int
+}
+
+type DayHashRate struct {
+	Day      time.Time
+	HashRate float64
+
+	total   float64
+	samples int
+}
+
+// trendWidth and trendHeight are the size of the hashrate trend charts
+const (
+	trendWidth  = 600
+	trendHeight = 100
+)
+
+// Points returns the daily averages as the points of an SVG polyline.
+func (t *AlgorithmTrend) Points() string {
+	var points []string
+	for i, day := range t.Days {
+		x := 0.0
+		if len(t.Days) > 1 {
+			x = float64(i) * trendWidth / float64(len(t.Days)-1)
+		}
+		y := float64(trendHeight)
+		if t.Max > 0 {
+			y -= day.HashRate / t.Max * (trendHeight - 10)
+		}
+		points = append(points, fmt.Sprintf("%0.1f,%0.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+func (r *RigReport) algorithm(name string) *AlgorithmTrend {
+	if t, ok := r.algorithms[name]; ok {
+		return t
+	}
+	t := &AlgorithmTrend{Algorithm: name, Min: math.MaxFloat64}
+	r.algorithms[name] = t
+	r.Algorithms = append(r.Algorithms, t)
+	return t
+}
+
+func (t *AlgorithmTrend) add(at time.Time, hashRate float64) {
+	t.total += hashRate
+	t.samples++
+	t.Min = math.Min(t.Min, hashRate)
+	t.Max = math.Max(t.Max, hashRate)
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	if len(t.Days) == 0 || !t.Days[len(t.Days)-1].Day.Equal(day) {
+		t.Days = append(t.Days, DayHashRate{Day: day})
+	}
+	d := &t.Days[len(t.Days)-1]
+	d.total += hashRate
+	d.samples++
+	d.HashRate = d.total / float64(d.samples)
+	t.Average = t.total / float64(t.samples)
+}
+
+// uptime returns the percentage of the time between from and to the rig was mining, measured by the wall clock. Stats
+// are only polled while the monitor sees the rig running, so reboots and power cycles leave gaps between polls rather
+// than failed polls. Each successful poll counts as up until the next poll, but for no longer than twice the usual
+// poll interval, and every other moment, including before the first poll, counts as down.
+func uptime(polls []StatsRecord, from, to time.Time) float64 {
+	if len(polls) < 2 || !to.After(from) {
+		return 0
+	}
+	var gaps []time.Duration
+	for i := 1; i < len(polls); i++ {
+		gaps = append(gaps, polls[i].Time.Sub(polls[i-1].Time))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	maxGap := 2 * gaps[len(gaps)/2]
+	var up time.Duration
+	for i, poll := range polls {
+		if poll.Stats == nil {
+			continue
+		}
+		end := to
+		if i+1 < len(polls) {
+			end = polls[i+1].Time
+		}
+		if gap := end.Sub(poll.Time); gap < maxGap {
+			up += gap
+		} else {
+			up += maxGap
+		}
+	}
+	return math.Min(float64(up)/float64(to.Sub(from))*100, 100)
+}
+
+// remediationSubjects prefix the subjects of the emails listed in the remediation history: reboots, power cycles and
+// rollouts which succeeded or failed, critical thresholds and scheduled reboots which weren't verified. Thresholds
+// exceeded on every failing poll are left out.
+var remediationSubjects = []string{"SUCCESSFULLY", "FAILED", "CRITICAL", "NOT applying", "Scheduled reboot"}
+
+func isRemediation(subject string) bool {
+	for _, prefix := range remediationSubjects {
+		if strings.HasPrefix(subject, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewReport builds a report of the stats recording and event recording between from and to, in the location of to.
+// The event recording may be empty, in which case the report has no remediation history.
+func NewReport(statsPath, eventsPath string, from, to time.Time) (*Report, error) {
+	stats, err := ReadStatsRecords(statsPath, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{From: from, To: to}
+	rigs := map[string]*RigReport{}
+	rig := func(name string) *RigReport {
+		r, ok := rigs[name]
+		if !ok {
+			r = &RigReport{Name: name, algorithms: map[string]*AlgorithmTrend{}}
+			rigs[name] = r
+			report.Rigs = append(report.Rigs, r)
+		}
+		return r
+	}
+	for _, record := range stats {
+		r := rig(record.Client)
+		r.Polls++
+		r.polls = append(r.polls, StatsRecord{Time: record.Time, Stats: record.Stats})
+		if record.Stats == nil {
+			r.FailedPolls++
+			continue
+		}
+		at := record.Time.In(to.Location())
+		algorithms := record.Stats.Algorithms
+		if len(algorithms) == 0 {
+			// recorded before algorithms were reported
+			algorithms = []AlgorithmStats{{HashRate: record.Stats.MainHashRate}}
+		}
+		for i, a := range algorithms {
+			name := a.Algorithm
+			if name == "" {
+				name = fmt.Sprintf("algorithm %d", i+1)
+			}
+			r.algorithm(name).add(at, a.HashRate)
+		}
+		if revenue := record.Stats.Revenue; revenue != nil {
+			r.HasRevenue = true
+			report.Currency = revenue.Currency
+			r.revenueTotal += revenue.PerDay
+			r.revenueSamples++
+			if revenue.PowerCostPerDay > 0 {
+				r.powerCostTotal += revenue.PowerCostPerDay
+				r.powerCostSamples++
+			}
+		}
+	}
+	if eventsPath != "" {
+		events, err := ReadEventRecords(eventsPath, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			r := rig(event.Client)
+			switch {
+			case event.Type == LogType && event.Message == rebootedMessage:
+				r.Reboots++
+			case event.Type == LogType && event.Message == powerCycledMessage:
+				r.PowerCycles++
+			case event.Type == EmailType && isRemediation(event.Subject):
+				if strings.HasPrefix(event.Subject, "FAILED") {
+					r.FailedRemediations++
+				}
+				report.Events = append(report.Events, event)
+			}
+		}
+	}
+	days := to.Sub(from).Hours() / 24
+	for _, r := range report.Rigs {
+		r.Uptime = uptime(r.polls, from, to)
+		if r.revenueSamples > 0 {
+			r.RevenuePerDay = r.revenueTotal / float64(r.revenueSamples)
+		}
+		if r.powerCostSamples > 0 {
+			r.PowerCostPerDay = r.powerCostTotal / float64(r.powerCostSamples)
+		}
+		// revenue is only earned while the rig is up, power is drawn regardless
+		r.Revenue = r.RevenuePerDay * days * r.Uptime / 100
+		r.PowerCost = r.PowerCostPerDay * days
+		r.Profit = r.Revenue - r.PowerCost
+		if r.HasRevenue {
+			report.HasRevenue = true
+			report.FleetRevenue += r.Revenue
+			report.FleetPowerCost += r.PowerCost
+			report.FleetProfit += r.Profit
+		}
+	}
+	sort.Slice(report.Rigs, func(i, j int) bool { return report.Rigs[i].Name < report.Rigs[j].Name })
+	return report, nil
+}
+
+// Summary is a plain text summary of the report, for sinks which can not display HTML.
+func (r *Report) Summary() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Report from %s to %s", r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04")))
+	for _, rig := range r.Rigs {
+		line := fmt.Sprintf("%s: uptime %0.2f%%, %d reboots, %d power cycles", rig.Name, rig.Uptime, rig.Reboots, rig.PowerCycles)
+		if rig.HasRevenue {
+			line += fmt.Sprintf(", revenue %0.2f %s, power cost %0.2f %s", rig.Revenue, r.Currency, rig.PowerCost, r.Currency)
+		}
+		lines = append(lines, line)
+	}
+	if r.HasRevenue {
+		lines = append(lines, fmt.Sprintf("Fleet: revenue %0.2f %s, power cost %0.2f %s, profit %0.2f %s", r.FleetRevenue,
+			r.Currency, r.FleetPowerCost, r.Currency, r.FleetProfit, r.Currency))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":     func(t time.Time) string { return t.Format("2006-01-02") },
+	"datetime": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>Mining report {{date .From}} to {{date .To}}</title>
+<style>
+body { font-family: sans-serif; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+.bad { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Mining report</h1>
+<p>{{datetime .From}} to {{datetime .To}}</p>
+{{if .HasRevenue}}
+<h2>Fleet</h2>
+<table>
+<tr><th>Revenue</th><td>{{printf "%0.2f" .FleetRevenue}} {{.Currency}}</td></tr>
+<tr><th>Power cost</th><td>{{printf "%0.2f" .FleetPowerCost}} {{.Currency}}</td></tr>
+<tr><th>Profit</th><td{{if lt .FleetProfit 0.0}} class="bad"{{end}}>{{printf "%0.2f" .FleetProfit}} {{.Currency}}</td></tr>
+</table>
+{{end}}
+{{range .Rigs}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Uptime</th><td{{if lt .Uptime 99.0}} class="bad"{{end}}>{{printf "%0.2f" .Uptime}}% ({{.FailedPolls}} of {{.Polls}} polls failed)</td></tr>
+<tr><th>Reboots</th><td>{{.Reboots}}</td></tr>
+<tr><th>Power cycles</th><td>{{.PowerCycles}}</td></tr>
+<tr><th>Failed remediations</th><td{{if .FailedRemediations}} class="bad"{{end}}>{{.FailedRemediations}}</td></tr>
+{{if .HasRevenue}}
+<tr><th>Revenue</th><td>{{printf "%0.2f" .Revenue}} {{$.Currency}} ({{printf "%0.2f" .RevenuePerDay}} per day)</td></tr>
+<tr><th>Power cost</th><td>{{printf "%0.2f" .PowerCost}} {{$.Currency}} ({{printf "%0.2f" .PowerCostPerDay}} per day)</td></tr>
+<tr><th>Profit</th><td{{if lt .Profit 0.0}} class="bad"{{end}}>{{printf "%0.2f" .Profit}} {{$.Currency}}</td></tr>
+{{end}}
+</table>
+{{range .Algorithms}}
+<h3>{{.Algorithm}} hashrate</h3>
+<p>average {{printf "%0.2f" .Average}}, min {{printf "%0.2f" .Min}}, max {{printf "%0.2f" .Max}}</p>
+<svg width="600" height="100" xmlns="http://www.w3.org/2000/svg">
+<rect width="600" height="100" fill="#f8f8f8"/>
+<polyline points="{{.Points}}" fill="none" stroke="#2a6ebb" stroke-width="2"/>
+</svg>
+<table>
+<tr><th>Day</th><th>Average hashrate</th></tr>
+{{range .Days}}<tr><td>{{date .Day}}</td><td>{{printf "%0.2f" .HashRate}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+<h2>Remediation history</h2>
+{{if .Events}}
+<table>
+<tr><th>Time</th><th>Rig</th><th>Event</th><th>Details</th></tr>
+{{range .Events}}<tr><td>{{datetime .Time}}</td><td>{{.Client}}</td><td>{{.Subject}}</td><td>{{.Message}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No remediations.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func (r *Report) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, r); err != nil {
+		return "", fmt.Errorf("failed to render report: %s", err)
+	}
+	return buf.String(), nil
+}
+
+// ReportPDF converts an HTML report to PDF with wkhtmltopdf, which must be installed.
+func ReportPDF(html string) ([]byte, error) {
+	cmd := exec.Command("wkhtmltopdf", "--quiet", "-", "-")
+	cmd.Stdin = strings.NewReader(html)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	pdf, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert report to pdf: %s %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return pdf, nil
+}
+
+// reportRunSlack allows for the scheduler waking slightly before the time a report is due.
+const reportRunSlack = time.Second
+
+// NewReportJob returns a Scheduler job emailing a report of the rigs recorded, through the event service, on behalf
+// of the client c. Each report covers the interval from the previous scheduled run to this one, e.g. the previous
+// month for a monthly schedule, so consecutive reports neither overlap nor leave gaps.
+func NewReportJob(c Client, es *EventService, schedule *Schedule, statsPath, eventsPath string, pdf bool) func() {
+	return func() {
+		now := time.Now().In(schedule.Location())
+		to := schedule.Previous(now.Add(reportRunSlack))
+		if to.IsZero() {
+			to = now
+		}
+		from := schedule.Previous(to)
+		if from.IsZero() {
+			from = to.Add(-schedule.Next(to).Sub(to))
+		}
+		report, err := NewReport(statsPath, eventsPath, from, to)
+		if err != nil {
+			es.E <- NewErrorEvent(c, fmt.Errorf("failed to generate report: %s", err))
+			return
+		}
+		html, err := report.HTML()
+		if err != nil {
+			es.E <- NewErrorEvent(c, err)
+			return
+		}
+		var attachments []Attachment
+		if pdf {
+			data, err := ReportPDF(html)
+			if err != nil {
+				es.E <- NewErrorEvent(c, err)
+			} else {
+				name := fmt.Sprintf("mining-report-%s.pdf", to.Format("2006-01-02"))
+				attachments = append(attachments, Attachment{Name: name, ContentType: "application/pdf", Data: data})
+			}
+		}
+		subject := fmt.Sprintf("Mining report %s to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+		es.E <- NewHTMLEmailEvent(c, subject, report.Summary(), html, attachments)
+	}
+}
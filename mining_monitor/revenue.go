@@ -0,0 +1,200 @@
+package mining_monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const coinGeckoAPI = "https://api.coingecko.com/api/v3"
+
+// PriceSource returns the current price of coins, keyed by coin.
+type PriceSource interface {
+	Prices(coins []string) (map[string]float64, error)
+}
+
+type coinGeckoPriceSource struct {
+	currency string
+	http     *http.Client
+}
+
+// NewCoinGeckoPriceSource returns prices in a currency e.g. usd from the CoinGecko API, coins are CoinGecko IDs
+// e.g. ethereum.
+func NewCoinGeckoPriceSource(currency string) PriceSource {
+	return &coinGeckoPriceSource{currency: strings.ToLower(currency), http: &http.Client{Timeout: httpTimeout}}
+}
+
+func (p *coinGeckoPriceSource) Prices(coins []string) (map[string]float64, error) {
+	query := url.Values{"ids": {strings.Join(coins, ",")}, "vs_currencies": {p.currency}}
+	resp, err := p.http.Get(coinGeckoAPI + "/simple/price?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices of %s: %s", strings.Join(coins, ","), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get prices of %s: %s", strings.Join(coins, ","), resp.Status)
+	}
+	var reply map[string]map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal prices of %s: %s", strings.Join(coins, ","), err)
+	}
+	prices := map[string]float64{}
+	for _, coin := range coins {
+		price, ok := reply[coin][p.currency]
+		if !ok {
+			return nil, fmt.Errorf("no %s price for %s", p.currency, coin)
+		}
+		prices[coin] = price
+	}
+	return prices, nil
+}
+
+// CoinReward is the coin an algorithm is mined to, and the coins earned per day per unit of hashrate in the unit
+// the miner reports, e.g. per kH/s for Claymore.
+type CoinReward struct {
+	Algorithm        string
+	Coin             string
+	CoinsPerHashRate float64
+}
+
+// ParseCoinRewards parses comma separated algorithm=coin:coinsPerHashRate rewards e.g. ethash=ethereum:0.00000004.
+func ParseCoinRewards(spec string) ([]CoinReward, error) {
+	var rewards []CoinReward
+	for _, reward := range strings.Split(spec, ",") {
+		parts := strings.SplitN(reward, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid coin reward %s, must be algorithm=coin:coinsPerHashRate", reward)
+		}
+		coin := strings.SplitN(parts[1], ":", 2)
+		if len(coin) != 2 {
+			return nil, fmt.Errorf("invalid coin reward %s, must be algorithm=coin:coinsPerHashRate", reward)
+		}
+		perHashRate, err := strconv.ParseFloat(coin[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coins per hashrate in %s: %s", reward, err)
+		}
+		rewards = append(rewards, CoinReward{Algorithm: parts[0], Coin: coin[0], CoinsPerHashRate: perHashRate})
+	}
+	return rewards, nil
+}
+
+// RevenueStats is the estimated revenue of a rig at its current hashrate and coin prices.
+type RevenueStats struct {
+	Currency        string
+	PerDay          float64
+	PowerCostPerDay float64
+	// FleetPerDay is the revenue of every rig sharing the RevenueFleet of this rig
+	FleetPerDay float64
+}
+
+// RevenueFleet sums the latest revenue of every rig monitored.
+type RevenueFleet struct {
+	mu   sync.Mutex
+	rigs map[string]float64
+}
+
+func NewRevenueFleet() *RevenueFleet {
+	return &RevenueFleet{rigs: map[string]float64{}}
+}
+
+// set records the revenue of a rig, returning the revenue of the fleet.
+func (f *RevenueFleet) set(rig string, perDay float64) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rigs[rig] = perDay
+	total := 0.0
+	for _, revenue := range f.rigs {
+		total += revenue
+	}
+	return total
+}
+
+// RevenueCollector estimates the revenue of each algorithm mined from its hashrate, coin reward and price. Prices
+// are refreshed once per interval, falling back to the last prices when the price source is unavailable. Until
+// prices are first read revenue is not estimated, which is logged once rather than on every poll. Prices are live,
+// so the interval is always in wall clock time, even in replays.
+type RevenueCollector struct {
+	name       string
+	ps         PriceSource
+	currency   string
+	rewards    []CoinReward
+	powerPrice float64
+	interval   time.Duration
+	fleet      *RevenueFleet
+
+	prices      map[string]float64
+	lastRead    time.Time
+	unavailable bool
+}
+
+// NewRevenueCollector returns a collector for the rig c, whose power is costed at powerPrice per kWh if non zero.
+// The revenue of the fleet is summed over every collector sharing the fleet, which may be nil.
+func NewRevenueCollector(c Client, ps PriceSource, currency string, rewards []CoinReward, powerPrice float64,
+	interval time.Duration, fleet *RevenueFleet) Collector {
+	return &RevenueCollector{name: c.IP(), ps: ps, currency: currency, rewards: rewards, powerPrice: powerPrice,
+		interval: interval, fleet: fleet}
+}
+
+// updatePrices refreshes the prices if they are older than the interval, returning whether there are any prices.
+func (r *RevenueCollector) updatePrices() bool {
+	if r.prices != nil && time.Since(r.lastRead) <= r.interval {
+		return true
+	}
+	var coins []string
+	for _, reward := range r.rewards {
+		coins = append(coins, reward.Coin)
+	}
+	prices, err := r.ps.Prices(coins)
+	if err != nil {
+		if r.prices == nil {
+			if !r.unavailable {
+				glog.Warningf("[%s] not estimating revenue until prices are read: %s", r.name, err)
+				r.unavailable = true
+			}
+			return false
+		}
+		glog.Warningf("[%s] using prices from %v: %s", r.name, r.lastRead, err)
+		return true
+	}
+	if r.unavailable {
+		glog.Infof("[%s] prices read, estimating revenue", r.name)
+		r.unavailable = false
+	}
+	r.prices = prices
+	r.lastRead = time.Now()
+	return true
+}
+
+func (r *RevenueCollector) Collect(stats *Statistics) error {
+	if !r.updatePrices() {
+		return nil
+	}
+	revenue := &RevenueStats{Currency: r.currency}
+	for _, reward := range r.rewards {
+		a := stats.Algorithm(reward.Algorithm)
+		if a == nil {
+			continue
+		}
+		a.Coin = reward.Coin
+		a.CoinsPerDay = a.HashRate * reward.CoinsPerHashRate
+		a.Price = r.prices[reward.Coin]
+		a.RevenuePerDay = a.CoinsPerDay * a.Price
+		revenue.PerDay += a.RevenuePerDay
+	}
+	if stats.PowerState != nil && r.powerPrice > 0 {
+		revenue.PowerCostPerDay = stats.PowerState.Power / 1000 * 24 * r.powerPrice
+	}
+	revenue.FleetPerDay = revenue.PerDay
+	if r.fleet != nil {
+		revenue.FleetPerDay = r.fleet.set(r.name, revenue.PerDay)
+	}
+	stats.Revenue = revenue
+	return nil
+}
@@ -0,0 +1,165 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const rolloutPollInterval = 30 * time.Second
+
+// RolloutFunc applies a change, such as a firmware update, to a client. The client is expected to restart once the
+// change is applied.
+type RolloutFunc func(c Client) error
+
+// Rollout applies a change to clients in batches. Every client must pass its thresholds before the change, and must
+// restart and pass them again within the RecoveryTimeout afterwards, otherwise the rollout stops before the next batch
+// and the clients which failed to recover are rolled back if a Rollback is given.
+type Rollout struct {
+	Name            string
+	BatchSize       int
+	Thresholds      []*Threshold
+	RecoveryTimeout time.Duration
+	PollInterval    time.Duration
+	EventService    *EventService
+
+	Apply    RolloutFunc
+	Rollback RolloutFunc
+	// Verify optionally checks the stats of a client after the change is applied, on top of the thresholds. It is
+	// not checked after a rollback, which undoes the change.
+	Verify func(stats *Statistics) error
+}
+
+// RolloutStage is a group of clients rolled out together, such as a canary group or a site.
+type RolloutStage struct {
+	Name    string
+	Clients []Client
+}
+
+// verify returns an error if the client stats can't be read or exceed any threshold. If since is not zero the client
+// must also have restarted after it, and if applied it must also pass Verify.
+func (r *Rollout) verify(c Client, since time.Time, applied bool) error {
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() {
+		if float64(stats.RunningTime) > time.Since(since).Minutes() {
+			return fmt.Errorf("client has not restarted, running for %d minutes", stats.RunningTime)
+		}
+		if applied && r.Verify != nil {
+			if err := r.Verify(stats); err != nil {
+				return err
+			}
+		}
+	}
+	var errors []error
+	for _, t := range r.Thresholds {
+		errors = append(errors, t.Check(stats)...)
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("thresholds exceeded: %s", fmtErrors(errors))
+	}
+	return nil
+}
+
+// recover polls the client until it verifies or the RecoveryTimeout passes, since the change was applied or, if not
+// applied, rolled back.
+func (r *Rollout) recover(c Client, since time.Time, applied bool) error {
+	for {
+		time.Sleep(r.PollInterval)
+		err := r.verify(c, since, applied)
+		if err == nil {
+			return nil
+		}
+		if time.Since(since) >= r.RecoveryTimeout {
+			return fmt.Errorf("did not recover within %v: %s", r.RecoveryTimeout, err)
+		}
+	}
+}
+
+// update applies the change to a single client and waits for it to recover, rolling it back if it doesn't.
+func (r *Rollout) update(c Client) error {
+	if err := r.verify(c, time.Time{}, false); err != nil {
+		r.EventService.E <- NewEmailEvent(c, fmt.Sprintf("NOT applying %s, client unhealthy", r.Name),
+			fmt.Sprintf("%s was not applied as the client was unhealthy before the update, the rollout stops after this batch: %s", r.Name, err))
+		return fmt.Errorf("unhealthy before update: %s", err)
+	}
+	r.EventService.E <- NewLogEvent(c, fmt.Sprintf("applying %s", r.Name))
+	applied := time.Now()
+	err := r.Apply(c)
+	if err == nil {
+		err = r.recover(c, applied, true)
+	}
+	if err == nil {
+		r.EventService.E <- NewLogEvent(c, fmt.Sprintf("%s applied and verified", r.Name))
+		return nil
+	}
+	if r.Rollback == nil {
+		r.EventService.E <- NewEmailEvent(c, fmt.Sprintf("FAILED %s, ROLLBACK REQUIRED", r.Name),
+			fmt.Sprintf("%s failed and no rollback is configured, the client needs manual attention: %s", r.Name, err))
+		return err
+	}
+	rolledBack := time.Now()
+	rollbackErr := r.Rollback(c)
+	if rollbackErr == nil {
+		rollbackErr = r.recover(c, rolledBack, false)
+	}
+	if rollbackErr != nil {
+		r.EventService.E <- NewEmailEvent(c, fmt.Sprintf("FAILED %s and rollback", r.Name),
+			fmt.Sprintf("%s failed: %s\nRollback also failed, the client needs manual attention: %s", r.Name, err, rollbackErr))
+	} else {
+		r.EventService.E <- NewEmailEvent(c, fmt.Sprintf("FAILED %s, rolled back", r.Name),
+			fmt.Sprintf("%s failed and the client was rolled back successfully: %s", r.Name, err))
+	}
+	return err
+}
+
+// Run applies the change to every client, BatchSize clients at a time. It returns once every client is updated or
+// after the first batch which fails.
+func (r *Rollout) Run(clients []Client) error {
+	batchSize := r.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	for start := 0; start < len(clients); start += batchSize {
+		end := start + batchSize
+		if end > len(clients) {
+			end = len(clients)
+		}
+		batch := clients[start:end]
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i, c := range batch {
+			wg.Add(1)
+			go func(i int, c Client) {
+				defer wg.Done()
+				errs[i] = r.update(c)
+			}(i, c)
+		}
+		wg.Wait()
+		var failed []error
+		for i, err := range errs {
+			if err != nil {
+				failed = append(failed, fmt.Errorf("%s: %s", batch[i].IP(), err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%s stopped after %d of %d clients: %s", r.Name, end, len(clients), fmtErrors(failed))
+		}
+	}
+	return nil
+}
+
+// RunStages runs the rollout on each stage in order, stopping at the first stage which fails.
+func (r *Rollout) RunStages(stages []RolloutStage) error {
+	for _, stage := range stages {
+		glog.Infof("%s: starting stage %s", r.Name, stage.Name)
+		if err := r.Run(stage.Clients); err != nil {
+			return fmt.Errorf("stage %s: %s", stage.Name, err)
+		}
+	}
+	return nil
+}
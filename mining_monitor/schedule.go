@@ -0,0 +1,145 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const cronTimezonePrefix = "CRON_TZ="
+
+// Schedule is a CronSchedule evaluated in a timezone, so rigs at sites in different timezones are scheduled by their
+// local time. Times repeated when daylight saving time ends only match once, and times skipped when it starts don't
+// match on that day.
+type Schedule struct {
+	cron *CronSchedule
+	loc  *time.Location
+}
+
+// ParseSchedule parses a cron expression evaluated in loc, or in the timezone given by a CRON_TZ= prefix e.g.
+// "CRON_TZ=America/Edmonton 0 4 * * 0". A nil loc is the local timezone.
+func ParseSchedule(spec string, loc *time.Location) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if strings.HasPrefix(expr, cronTimezonePrefix) {
+		fields := strings.SplitN(expr, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid schedule %q, missing cron expression", spec)
+		}
+		var err error
+		if loc, err = time.LoadLocation(strings.TrimPrefix(fields[0], cronTimezonePrefix)); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %s", spec, err)
+		}
+		expr = fields[1]
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	cron, err := ParseCronSchedule(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Schedule{cron: cron, loc: loc}, nil
+}
+
+// Next returns the first time after t matching the schedule, or the zero time if it never matches.
+func (s *Schedule) Next(t time.Time) time.Time {
+	for {
+		next := s.cron.Next(t.In(s.loc))
+		if next.IsZero() {
+			return next
+		}
+		// the second occurrence of a wall clock time repeated by a daylight saving change
+		if earlier := next.Add(-time.Hour); earlier.Hour() == next.Hour() && earlier.Minute() == next.Minute() {
+			t = next
+			continue
+		}
+		return next
+	}
+}
+
+// maxScheduleLookback is how far Previous looks back for a match, far enough for schedules matching only on leap days.
+const maxScheduleLookback = 10 * 366 * 24 * time.Hour
+
+// Previous returns the last time before t matching the schedule, or the zero time if it has not matched within
+// maxScheduleLookback. It looks back over windows doubling in length until one holds a match, taking the last match in it.
+func (s *Schedule) Previous(t time.Time) time.Time {
+	for lookback := time.Hour; lookback <= 2*maxScheduleLookback; lookback *= 2 {
+		var prev time.Time
+		for next := s.Next(t.Add(-lookback)); !next.IsZero() && next.Before(t); next = s.Next(next) {
+			prev = next
+		}
+		if !prev.IsZero() {
+			return prev
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+func (s *Schedule) String() string {
+	return fmt.Sprintf("%s (%s)", s.cron, s.loc)
+}
+
+type scheduledJob struct {
+	name     string
+	schedule *Schedule
+	run      func()
+}
+
+// Scheduler runs jobs on their schedules until stopped. Each job runs in its own goroutine, and a job still running
+// when it is next due skips that run.
+type Scheduler struct {
+	jobs []scheduledJob
+	stop chan bool
+	wg   sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add must be called before Start.
+func (s *Scheduler) Add(name string, schedule *Schedule, run func()) {
+	s.jobs = append(s.jobs, scheduledJob{name: name, schedule: schedule, run: run})
+}
+
+func (s *Scheduler) Start() {
+	s.stop = make(chan bool)
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.runJob(job)
+	}
+}
+
+// Stop blocks until any running job has finished.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) runJob(job scheduledJob) {
+	defer s.wg.Done()
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			glog.Infof("schedule %s of %s never matches, not running it", job.schedule, job.name)
+			return
+		}
+		glog.V(1).Infof("next %s at %v", job.name, next)
+		timer := time.NewTimer(next.Sub(time.Now()))
+		select {
+		case <-timer.C:
+			glog.Infof("running scheduled %s", job.name)
+			job.run()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package mining_monitor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const sshTimeout = 10 * time.Second
+
+type ShellService interface {
+	Run(cmd string) (string, error)
+	// Upload writes data to the file at path on the rig.
+	Upload(path string, data []byte) error
+}
+
+type SSHShellService struct {
+	Addr string
+
+	config *ssh.ClientConfig
+}
+
+// NewSSHShellService returns a ShellService which runs commands on the rig over SSH. Either a password or a
+// private key file must be given. Host keys are not verified as rigs are expected to live on the local network.
+func NewSSHShellService(addr, user, password, keyFile string) (ShellService, error) {
+	var auth []ssh.AuthMethod
+	if keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssh key %s: %s", keyFile, err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ssh key %s: %s", keyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("ssh password or key file required for %s", addr)
+	}
+	return &SSHShellService{
+		Addr: addr,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         sshTimeout,
+		},
+	}, nil
+}
+
+func (s *SSHShellService) session() (*ssh.Client, *ssh.Session, error) {
+	client, err := ssh.Dial("tcp", s.Addr, s.config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh addr %s: %s", s.Addr, err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to open ssh session to %s: %s", s.Addr, err)
+	}
+	return client, session, nil
+}
+
+func (s *SSHShellService) Run(cmd string) (string, error) {
+	client, session, err := s.session()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("command %q failed on %s: %s: %s", cmd, s.Addr, err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (s *SSHShellService) Upload(path string, data []byte) error {
+	client, session, err := s.session()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(data)
+	if out, err := session.CombinedOutput(fmt.Sprintf("cat > '%s'", path)); err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %s: %s", path, s.Addr, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// bootDeviceCommand prints the disk the root filesystem is mounted from, or the source device itself when / is
+	// on a whole disk without partitions
+	bootDeviceCommand = "src=$(findmnt -n -o SOURCE /) && pk=$(lsblk -no pkname $src | head -n 1) && " +
+		"if [ -n \"$pk\" ]; then echo /dev/$pk; else echo $src; fi"
+	smartCommand = "sudo -n smartctl -H -A %s || true"
+
+	smartReallocatedSectors   = "5"
+	smartPendingSectors       = "197"
+	smartOfflineUncorrectable = "198"
+)
+
+type DiskHealth struct {
+	Device string
+	Passed bool
+
+	ReallocatedSectors   float64
+	PendingSectors       float64
+	OfflineUncorrectable float64
+}
+
+func (d DiskHealth) String() string {
+	return fmt.Sprintf("{Device: %s, Passed: %t, Reallocated: %0.0f, Pending: %0.0f, Uncorrectable: %0.0f}",
+		d.Device, d.Passed, d.ReallocatedSectors, d.PendingSectors, d.OfflineUncorrectable)
+}
+
+// SmartCollector reads the SMART health of a disk of the rig, by default the one it boots from. As SMART
+// attributes change slowly they are only read once per interval.
+type SmartCollector struct {
+	sh       ShellService
+	device   string
+	interval time.Duration
+	clock    Clock
+
+	health   *DiskHealth
+	lastRead time.Time
+}
+
+// NewSmartCollector checks the given device, or the boot drive when empty which is resolved on the first read.
+func NewSmartCollector(sh ShellService, device string, interval time.Duration) Collector {
+	return &SmartCollector{sh: sh, device: device, interval: interval, clock: NewWallClock()}
+}
+
+func (s *SmartCollector) setClock(clock Clock) {
+	s.clock = clock
+}
+
+func (s *SmartCollector) resolveDevice() error {
+	if s.device != "" {
+		return nil
+	}
+	out, err := s.sh.Run(bootDeviceCommand)
+	if err != nil {
+		return fmt.Errorf("failed to resolve boot drive: %s", err)
+	}
+	device := strings.TrimSpace(out)
+	if !strings.HasPrefix(device, "/dev/") {
+		return fmt.Errorf("failed to resolve boot drive, got %s", device)
+	}
+	s.device = device
+	return nil
+}
+
+func (s *SmartCollector) Collect(stats *Statistics) error {
+	if s.health == nil || s.clock.Now().Sub(s.lastRead) > s.interval {
+		health, err := s.read()
+		if err != nil {
+			return err
+		}
+		s.health = health
+		s.lastRead = s.clock.Now()
+	}
+	stats.Disk = s.health
+	return nil
+}
+
+func (s *SmartCollector) read() (*DiskHealth, error) {
+	if err := s.resolveDevice(); err != nil {
+		return nil, err
+	}
+	out, err := s.sh.Run(fmt.Sprintf(smartCommand, s.device))
+	if err != nil {
+		return nil, err
+	}
+	health := &DiskHealth{Device: s.device}
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "SMART overall-health self-assessment test result:") ||
+			strings.HasPrefix(line, "SMART Health Status:") {
+			found = true
+			health.Passed = strings.Contains(line, "PASSED") || strings.Contains(line, "OK")
+			continue
+		}
+		// ID# ATTRIBUTE_NAME FLAG VALUE WORST THRESH TYPE UPDATED WHEN_FAILED RAW_VALUE
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		var dst *float64
+		switch fields[0] {
+		case smartReallocatedSectors:
+			dst = &health.ReallocatedSectors
+		case smartPendingSectors:
+			dst = &health.PendingSectors
+		case smartOfflineUncorrectable:
+			dst = &health.OfflineUncorrectable
+		default:
+			continue
+		}
+		if *dst, err = strconv.ParseFloat(fields[9], 64); err != nil {
+			return nil, fmt.Errorf("failed to parse SMART attribute from %s: %s", line, err)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("SMART not available on %s: %s", s.device, strings.TrimSpace(out))
+	}
+	return health, nil
+}
@@ -0,0 +1,153 @@
+package mining_monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// StatsRecord is a single line of a stats recording.
+type StatsRecord struct {
+	Time   time.Time   `json:"time"`
+	Client string      `json:"client"`
+	Stats  *Statistics `json:"stats,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// StatsRecorder appends every stats poll, including the data added by collectors, to a file as JSON lines which can
+// be played back with a ReplayClient.
+type StatsRecorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewStatsRecorder(path string) (*StatsRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stats recording %s: %s", path, err)
+	}
+	return &StatsRecorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *StatsRecorder) Record(c Client, stats *Statistics, err error) error {
+	record := StatsRecord{Time: time.Now(), Client: c.IP(), Stats: stats}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to record stats to %s: %s", r.f.Name(), err)
+	}
+	return nil
+}
+
+func (r *StatsRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// readRecords calls add with each JSON line of a recording.
+func readRecords(path string, add func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open recording %s: %s", path, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if err := add(scanner.Bytes()); err != nil {
+			return fmt.Errorf("failed to parse recording %s line %d: %s", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read recording %s: %s", path, err)
+	}
+	return nil
+}
+
+// ReadStatsRecords returns the stats recorded from, and before, to.
+func ReadStatsRecords(path string, from, to time.Time) ([]StatsRecord, error) {
+	var records []StatsRecord
+	err := readRecords(path, func(line []byte) error {
+		var record StatsRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		if !record.Time.Before(from) && record.Time.Before(to) {
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// EventRecord is a single line of an event recording.
+type EventRecord struct {
+	Time    time.Time `json:"time"`
+	Client  string    `json:"client"`
+	Type    int       `json:"type"`
+	Subject string    `json:"subject,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// EventRecorder is an EventSink appending every event to a file as JSON lines, keeping the remediation history of
+// the rigs for reports. HTML emails, such as the reports themselves, are not recorded.
+type EventRecorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewEventRecorder(path string) (*EventRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event recording %s: %s", path, err)
+	}
+	return &EventRecorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *EventRecorder) Handle(e Event) error {
+	if e.HTML != "" {
+		return nil
+	}
+	record := EventRecord{Time: time.Now(), Client: e.Client.IP(), Type: e.Type, Subject: e.Subject, Message: e.Message}
+	if e.Error != nil {
+		record.Error = e.Error.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to record event to %s: %s", r.f.Name(), err)
+	}
+	return nil
+}
+
+func (r *EventRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// ReadEventRecords returns the events recorded from, and before, to.
+func ReadEventRecords(path string, from, to time.Time) ([]EventRecord, error) {
+	var records []EventRecord
+	err := readRecords(path, func(line []byte) error {
+		var record EventRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		if !record.Time.Before(from) && record.Time.Before(to) {
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
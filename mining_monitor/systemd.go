@@ -0,0 +1,75 @@
+package mining_monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SdNotify sends a state such as "READY=1" to systemd when running as a Type=notify service. It returns false
+// without error when not running under systemd.
+func SdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	if socket[0] == '@' {
+		// abstract namespace socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to systemd notify socket: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %s", err)
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval returns the watchdog timeout systemd expects pings within, or 0 if the watchdog is disabled.
+func SdWatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %s", usec)
+	}
+	return time.Duration(n) * time.Microsecond, nil
+}
+
+// RunSdWatchdog pings the systemd watchdog at half its timeout for as long as the monitor is healthy, so systemd
+// restarts the monitor if any of its loops wedge. It returns once stop is closed or straight away if the watchdog
+// is not enabled.
+func RunSdWatchdog(m *Monitor, stop <-chan struct{}) error {
+	interval, err := SdWatchdogInterval()
+	if err != nil || interval == 0 {
+		return err
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Healthy(); err != nil {
+				glog.Infof("monitor unhealthy, not pinging systemd watchdog: %s", err)
+				continue
+			}
+			if _, err := SdNotify("WATCHDOG=1"); err != nil {
+				glog.Infof("%s", err)
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
@@ -2,8 +2,12 @@ package mining_monitor
 
 import (
 	"fmt"
+	"math"
+	"net"
+	"time"
 
 	"strconv"
+	"strings"
 
 	"github.com/golang/glog"
 )
@@ -58,6 +62,27 @@ type Threshold struct {
 	CauseReboot bool
 	SendEmail   bool
 	Name        string
+
+	// CausePowerCycle skips the reboot attempts and power cycles the client as soon as the threshold is exceeded,
+	// falling back to a reboot if power cycling is not enabled.
+	CausePowerCycle bool
+
+	// CauseImmediateReboot skips the failed checks before a reboot and reboots the client as soon as the threshold is
+	// exceeded.
+	CauseImmediateReboot bool
+
+	// Critical thresholds are emailed on their own as soon as they are exceeded, rather than with the other thresholds.
+	Critical bool
+
+	// clock is the time of the client, which thresholds measuring windows read through now
+	clock Clock
+}
+
+func (t *Threshold) now() time.Time {
+	if t.clock == nil {
+		return time.Now()
+	}
+	return t.clock.Now()
 }
 
 func (t Threshold) String() string {
@@ -156,3 +181,748 @@ func NewFanPercentThreshold(threshold string, causeReboot, sendEmail bool) (*Thr
 		Name:        "FanPercent",
 	}, nil
 }
+
+// NewKernelErrorThreshold reboots the client as soon as a critical kernel error is logged, or power cycles it if
+// causePowerCycle. Each error is only reported once, so waiting for further failed checks would never remediate it.
+func NewKernelErrorThreshold(causePowerCycle, sendEmail bool) (*Threshold, error) {
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			var errors []error
+			for _, line := range stats.KernelErrors {
+				errors = append(errors, fmt.Errorf("kernel error: %s", line))
+			}
+			return errors
+		},
+		Threshold:            "new kernel errors",
+		CauseReboot:          true,
+		CauseImmediateReboot: true,
+		CausePowerCycle:      causePowerCycle,
+		SendEmail:            sendEmail,
+		Critical:             true,
+		Name:                 "KernelLog",
+	}, nil
+}
+
+// counterWindow is the window over which the growth of error counters is measured.
+const counterWindow = time.Hour
+
+type counterSample struct {
+	at    time.Time
+	count float64
+}
+
+// counterGrowth tracks a per device counter and returns how much it has grown within counterWindow.
+type counterGrowth map[int][]counterSample
+
+func (g counterGrowth) add(device int, count float64, now time.Time) float64 {
+	samples := g[device]
+	if len(samples) > 0 && count < samples[len(samples)-1].count {
+		// counter was reset, most likely by a reboot
+		samples = nil
+	}
+	for len(samples) > 0 && now.Sub(samples[0].at) > counterWindow {
+		samples = samples[1:]
+	}
+	samples = append(samples, counterSample{at: now, count: count})
+	g[device] = samples
+	return count - samples[0].count
+}
+
+// NewMemoryErrorThreshold compares the growth of GPU ECC errors and retired pages within the last hour against the
+// threshold, giving warning of failing VRAM before the hashrate drops.
+func NewMemoryErrorThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	eccErrors := counterGrowth{}
+	retiredPages := counterGrowth{}
+	t := &Threshold{
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "MemoryErrors",
+	}
+	t.Check = func(stats *Statistics) []error {
+		var errors []error
+		now := t.now()
+		for i, count := range stats.GpuMemoryErrors {
+			growth := eccErrors.add(i, count, now)
+			glog.V(2).Infof("GPU %d memory errors %0.0f, %0.0f in the last %v", i, count, growth, counterWindow)
+			if comp(growth, number) {
+				errors = append(errors, fmt.Errorf("GPU %d memory error threshold exceeded %0.0f%s per %v", i, growth, threshold, counterWindow))
+			}
+		}
+		for i, count := range stats.GpuRetiredPages {
+			growth := retiredPages.add(i, count, now)
+			glog.V(2).Infof("GPU %d retired pages %0.0f, %0.0f in the last %v", i, count, growth, counterWindow)
+			if comp(growth, number) {
+				errors = append(errors, fmt.Errorf("GPU %d retired pages threshold exceeded %0.0f%s per %v", i, growth, threshold, counterWindow))
+			}
+		}
+		return errors
+	}
+	return t, nil
+}
+
+func parseFloatThreshold(threshold string) (FloatComparison, float64, error) {
+	comp := FloatComparatorFromstring(threshold)
+	number, err := strconv.ParseFloat(threshold[1:], 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unknown threshold found %s, a threshold must have a first character of '>|<' followed by a number: %s", threshold, err)
+	}
+	return comp, number, nil
+}
+
+func NewHostLoadThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if stats.Host == nil {
+				return nil
+			}
+			glog.V(2).Infof("host load %0.2f", stats.Host.Load5)
+			if comp(stats.Host.Load5, number) {
+				return []error{fmt.Errorf("host load threshold exceeded %0.2f%s", stats.Host.Load5, threshold)}
+			}
+			return nil
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "HostLoad",
+	}, nil
+}
+
+func NewHostMemoryThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if stats.Host == nil {
+				return nil
+			}
+			used := stats.Host.MemUsedPercent()
+			glog.V(2).Infof("host memory used %0.2f%%", used)
+			if comp(used, number) {
+				return []error{fmt.Errorf("host memory used threshold exceeded %0.2f%s", used, threshold)}
+			}
+			return nil
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "HostMemory",
+	}, nil
+}
+
+func NewDiskUsageThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if stats.Host == nil {
+				return nil
+			}
+			var errors []error
+			for mount, used := range stats.Host.DiskUsedPercents {
+				glog.V(2).Infof("disk %s used %0.2f%%", mount, used)
+				if comp(used, number) {
+					errors = append(errors, fmt.Errorf("disk %s used threshold exceeded %0.2f%s", mount, used, threshold))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "DiskUsage",
+	}, nil
+}
+
+func NewHostTemperatureThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if stats.Host == nil {
+				return nil
+			}
+			var errors []error
+			for i, temp := range stats.Host.Temperatures {
+				glog.V(2).Infof("host thermal zone %d temperature %0.2f", i, temp)
+				if comp(temp, number) {
+					errors = append(errors, fmt.Errorf("host thermal zone %d temperature threshold exceeded %0.2f%s", i, temp, threshold))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "HostTemp",
+	}, nil
+}
+
+// NewNetErrorThreshold compares the growth of network interface errors within the last hour against the threshold.
+func NewNetErrorThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	netErrors := counterGrowth{}
+	t := &Threshold{
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "NetErrors",
+	}
+	t.Check = func(stats *Statistics) []error {
+		if stats.Host == nil {
+			return nil
+		}
+		growth := netErrors.add(0, stats.Host.NetErrors, t.now())
+		glog.V(2).Infof("host network errors %0.0f, %0.0f in the last %v", stats.Host.NetErrors, growth, counterWindow)
+		if comp(growth, number) {
+			return []error{fmt.Errorf("host network error threshold exceeded %0.0f%s per %v", growth, threshold, counterWindow)}
+		}
+		return nil
+	}
+	return t, nil
+}
+
+// NewSmartThreshold compares the reallocated, pending and offline uncorrectable sector counts of the disk against
+// the threshold, and always fails if the disk fails its SMART self-assessment.
+func NewSmartThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if stats.Disk == nil {
+				return nil
+			}
+			glog.V(2).Infof("disk health %s", stats.Disk)
+			var errors []error
+			if !stats.Disk.Passed {
+				errors = append(errors, fmt.Errorf("disk %s failed SMART self-assessment", stats.Disk.Device))
+			}
+			sectors := []struct {
+				name  string
+				count float64
+			}{
+				{"reallocated", stats.Disk.ReallocatedSectors},
+				{"pending", stats.Disk.PendingSectors},
+				{"offline uncorrectable", stats.Disk.OfflineUncorrectable},
+			}
+			for _, s := range sectors {
+				if comp(s.count, number) {
+					errors = append(errors, fmt.Errorf("disk %s %s sectors threshold exceeded %0.0f%s", stats.Disk.Device, s.name, s.count, threshold))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "SMART",
+	}, nil
+}
+
+// NewPcieLinkThreshold fails when a GPU negotiates a narrower or slower PCIe link than the best link it has been
+// seen on since the monitor started, such as a GPU dropping from x4 to x1 on a flaky riser. The max link of the
+// GPU's slot can not be used, as neither the GPU nor the slot can see a riser between them and a GPU on a x1 riser
+// in a x16 slot would always be degraded. GPUs lower their link generation to save power when idle, so the
+// generation is only checked while the GPU is hashing.
+func NewPcieLinkThreshold(causeReboot, sendEmail bool) (*Threshold, error) {
+	bestWidths := map[int]float64{}
+	bestGens := map[int]float64{}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			var errors []error
+			for i, width := range stats.GpuPcieLinkWidths {
+				best := math.Max(bestWidths[i], width)
+				bestWidths[i] = best
+				glog.V(2).Infof("GPU %d pcie link width x%0.0f best x%0.0f", i, width, best)
+				if width < best {
+					errors = append(errors, fmt.Errorf("GPU %d pcie link width degraded x%0.0f<x%0.0f", i, width, best))
+				}
+			}
+			for i, gen := range stats.GpuPcieLinkGens {
+				if floatAt(stats.MainGpuHashRate, i) == 0 {
+					continue
+				}
+				best := math.Max(bestGens[i], gen)
+				bestGens[i] = best
+				glog.V(2).Infof("GPU %d pcie link gen %0.0f best %0.0f", i, gen, best)
+				if gen < best {
+					errors = append(errors, fmt.Errorf("GPU %d pcie link gen degraded %0.0f<%0.0f", i, gen, best))
+				}
+			}
+			return errors
+		},
+		Threshold:   "link degraded",
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "PcieLink",
+	}, nil
+}
+
+func NewBoardHashRateThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			var errors []error
+			for _, board := range stats.Boards {
+				glog.V(2).Infof("board %d hashrate %0.2f", board.Chain, board.HashRate)
+				if comp(board.HashRate, number) {
+					errors = append(errors, fmt.Errorf("board %d hashrate threshold exceeded %0.2f%s", board.Chain, board.HashRate, threshold))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "BoardHashRate",
+	}, nil
+}
+
+// parseExpectedThreshold parses a threshold relative to an expected value, e.g. <expected*0.9 is exceeded when a
+// value drops below 90% of what is expected of it.
+func parseExpectedThreshold(threshold string) (FloatComparison, float64, error) {
+	comp := FloatComparatorFromstring(threshold)
+	if !strings.HasPrefix(threshold[1:], "expected") {
+		return nil, 0, fmt.Errorf("unknown threshold found %s, an expected threshold must have a first character of '>|<' followed by expected[*factor]", threshold)
+	}
+	factor := 1.0
+	if rest := strings.TrimPrefix(threshold[1:], "expected"); rest != "" {
+		var err error
+		if !strings.HasPrefix(rest, "*") {
+			return nil, 0, fmt.Errorf("unknown threshold found %s, an expected threshold must have a first character of '>|<' followed by expected[*factor]", threshold)
+		}
+		if factor, err = strconv.ParseFloat(rest[1:], 64); err != nil {
+			return nil, 0, fmt.Errorf("invalid factor in threshold %s: %s", threshold, err)
+		}
+	}
+	return comp, factor, nil
+}
+
+// IsExpectedThreshold returns whether a threshold is relative to the expected hashrate of the hardware.
+func IsExpectedThreshold(threshold string) bool {
+	return strings.Contains(threshold, "expected")
+}
+
+// NewExpectedHashRateThreshold compares the hashrate of each GPU to the hashrate expected of its model, or when the
+// miner does not report per GPU hashrates the hashrate of the whole miner to the hashrate expected of the miner
+// model. GPUs and miners whose model is unknown, or missing from the database, are not checked.
+func NewExpectedHashRateThreshold(threshold string, db HashRateDatabase, algorithm string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, factor, err := parseExpectedThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if len(stats.MainGpuHashRate) == 0 {
+				expected, ok := db.Expected(stats.Model, algorithm)
+				if !ok {
+					glog.V(2).Infof("no expected %s hashrate for model %s", algorithm, stats.Model)
+					return nil
+				}
+				glog.V(2).Infof("hashrate %0.2f expected %0.2f", stats.MainHashRate, expected)
+				if comp(stats.MainHashRate, expected*factor) {
+					return []error{fmt.Errorf("hashrate threshold exceeded %0.2f%s, expected %0.2f of %s", stats.MainHashRate, threshold, expected, stats.Model)}
+				}
+				return nil
+			}
+			var errors []error
+			for i, hash := range stats.MainGpuHashRate {
+				model := stringAt(stats.GpuModels, i)
+				expected, ok := db.Expected(model, algorithm)
+				if !ok {
+					glog.V(2).Infof("no expected %s hashrate for GPU %d model %s", algorithm, i, model)
+					continue
+				}
+				glog.V(2).Infof("GPU %d hashrate %0.2f expected %0.2f", i, hash, expected)
+				if comp(hash, expected*factor) {
+					errors = append(errors, fmt.Errorf("GPU %d threshold exceeded %0.2f%s, expected %0.2f of %s", i, hash, threshold, expected, model))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "HashRate",
+	}, nil
+}
+
+// NewExpectedBoardHashRateThreshold compares the hashrate of each board to its share of the hashrate expected of
+// the miner model. The share is taken of the boards the miner is built with, so a dead board does not raise the
+// expectation of the others.
+func NewExpectedBoardHashRateThreshold(threshold string, db HashRateDatabase, algorithm string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, factor, err := parseExpectedThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			expected, ok := db.Expected(stats.Model, algorithm)
+			if !ok || len(stats.Boards) == 0 {
+				glog.V(2).Infof("no expected %s hashrate for model %s", algorithm, stats.Model)
+				return nil
+			}
+			count := stats.BoardCount
+			if count < len(stats.Boards) {
+				count = len(stats.Boards)
+			}
+			expected /= float64(count)
+			var errors []error
+			for _, board := range stats.Boards {
+				glog.V(2).Infof("board %d hashrate %0.2f expected %0.2f", board.Chain, board.HashRate, expected)
+				if comp(board.HashRate, expected*factor) {
+					errors = append(errors, fmt.Errorf("board %d hashrate threshold exceeded %0.2f%s, expected %0.2f", board.Chain, board.HashRate, threshold, expected))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "BoardHashRate",
+	}, nil
+}
+
+// NewAlgorithmHashRateThreshold compares the hashrate of each GPU mining an algorithm, or the hashrate of the whole
+// miner if it does not report per GPU hashrates. Miners not mining the algorithm are not checked.
+func NewAlgorithmHashRateThreshold(algorithm, threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			a := stats.Algorithm(algorithm)
+			if a == nil {
+				glog.V(2).Infof("%s is not being mined", algorithm)
+				return nil
+			}
+			if len(a.GpuHashRate) == 0 {
+				glog.V(2).Infof("%s hashrate %0.2f", algorithm, a.HashRate)
+				if comp(a.HashRate, number) {
+					return []error{fmt.Errorf("%s hashrate threshold exceeded %0.2f%s", algorithm, a.HashRate, threshold)}
+				}
+				return nil
+			}
+			var errors []error
+			for i, hash := range a.GpuHashRate {
+				glog.V(2).Infof("GPU %d %s hashrate %0.2f", i, algorithm, hash)
+				if comp(hash, number) {
+					errors = append(errors, fmt.Errorf("GPU %d %s hashrate threshold exceeded %0.2f%s", i, algorithm, hash, threshold))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        algorithm + " HashRate",
+	}, nil
+}
+
+// NewAlgorithmRejectedSharesThreshold compares the percentage of the shares of an algorithm which were rejected.
+func NewAlgorithmRejectedSharesThreshold(algorithm, threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			a := stats.Algorithm(algorithm)
+			if a == nil || a.Shares+a.RejectedShares == 0 {
+				return nil
+			}
+			rejected := float64(a.RejectedShares) / float64(a.Shares+a.RejectedShares) * 100
+			glog.V(2).Infof("%s rejected shares %0.2f%%", algorithm, rejected)
+			if comp(rejected, number) {
+				return []error{fmt.Errorf("%s rejected shares threshold exceeded %0.2f%s", algorithm, rejected, threshold)}
+			}
+			return nil
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        algorithm + " RejectedShares",
+	}, nil
+}
+
+// NewBoardTemperatureThreshold compares the highest of the board and chip temperatures of each board.
+func NewBoardTemperatureThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			var errors []error
+			for _, board := range stats.Boards {
+				temp := math.Max(board.Temperature, board.ChipTemperature)
+				glog.V(2).Infof("board %d temperature %0.2f", board.Chain, temp)
+				if comp(temp, number) {
+					errors = append(errors, fmt.Errorf("board %d temperature threshold exceeded %0.2f%s", board.Chain, temp, threshold))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "BoardTemp",
+	}, nil
+}
+
+// NewBoardChipThreshold compares the number of chips detected on each board, and fails for any board which has
+// disappeared since it was last seen.
+func NewBoardChipThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			var errors []error
+			present := map[int]bool{}
+			for _, board := range stats.Boards {
+				present[board.Chain] = true
+				seen[board.Chain] = true
+				glog.V(2).Infof("board %d chips %0.0f", board.Chain, board.Chips)
+				if comp(board.Chips, number) {
+					errors = append(errors, fmt.Errorf("board %d chip threshold exceeded %0.0f%s", board.Chain, board.Chips, threshold))
+				}
+			}
+			for chain := range seen {
+				if !present[chain] {
+					errors = append(errors, fmt.Errorf("board %d is missing", chain))
+				}
+			}
+			return errors
+		},
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "BoardChips",
+	}, nil
+}
+
+// NewBoardHardwareErrorThreshold compares the growth of hardware errors of each board within the last hour against
+// the threshold.
+func NewBoardHardwareErrorThreshold(threshold string, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	hwErrors := counterGrowth{}
+	t := &Threshold{
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "BoardHardwareErrors",
+	}
+	t.Check = func(stats *Statistics) []error {
+		var errors []error
+		now := t.now()
+		for _, board := range stats.Boards {
+			growth := hwErrors.add(board.Chain, board.HardwareErrors, now)
+			glog.V(2).Infof("board %d hardware errors %0.0f, %0.0f in the last %v", board.Chain, board.HardwareErrors, growth, counterWindow)
+			if comp(growth, number) {
+				errors = append(errors, fmt.Errorf("board %d hardware error threshold exceeded %0.0f%s per %v", board.Chain, growth, threshold, counterWindow))
+			}
+		}
+		return errors
+	}
+	return t, nil
+}
+
+// walletMatches returns true if wallet is the expected wallet, optionally followed by a worker name as in
+// wallet.worker or wallet/worker. Wallets are compared ignoring case, as Ethereum addresses may be checksummed.
+func walletMatches(wallet, expected string) bool {
+	if len(wallet) < len(expected) || !strings.EqualFold(wallet[:len(expected)], expected) {
+		return false
+	}
+	return len(wallet) == len(expected) || strings.ContainsAny(wallet[len(expected):len(expected)+1], "./+")
+}
+
+// poolsUnreadable fails the pool checks when the pools could not be read, as no pools would otherwise pass them.
+func poolsUnreadable(stats *Statistics) []error {
+	if stats.PoolsError == "" {
+		return nil
+	}
+	return []error{fmt.Errorf("pool configuration could not be read: %s", stats.PoolsError)}
+}
+
+// NewWalletThreshold is a critical threshold failing when any pool configured on the miner mines to a wallet other
+// than the comma separated expected wallets, such as after a firmware hijack or fee redirecting malware.
+func NewWalletThreshold(wallets string, causeReboot, sendEmail bool) (*Threshold, error) {
+	var expected []string
+	for _, wallet := range strings.Split(wallets, ",") {
+		if wallet = strings.TrimSpace(wallet); wallet != "" {
+			expected = append(expected, wallet)
+		}
+	}
+	if len(expected) == 0 {
+		return nil, fmt.Errorf("no expected wallets in %s", wallets)
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if errors := poolsUnreadable(stats); errors != nil {
+				return errors
+			}
+			var errors []error
+			for _, pool := range stats.Pools {
+				found := false
+				for _, wallet := range expected {
+					found = found || walletMatches(pool.Wallet, wallet)
+				}
+				if !found {
+					errors = append(errors, fmt.Errorf("pool %s is mining to unexpected wallet %s", pool.URL, pool.Wallet))
+				}
+			}
+			return errors
+		},
+		Threshold:   wallets,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Critical:    true,
+		Name:        "Wallet",
+	}, nil
+}
+
+// poolHost returns the host of a pool URL, which may or may not have a scheme and port e.g.
+// stratum+tcp://eth-us.nanopool.org:9999 or eth-us.nanopool.org:9999.
+func poolHost(pool string) string {
+	pool = strings.TrimSpace(pool)
+	if i := strings.Index(pool, "://"); i >= 0 {
+		pool = pool[i+3:]
+	}
+	if i := strings.IndexAny(pool, "/?#"); i >= 0 {
+		pool = pool[:i]
+	}
+	if i := strings.LastIndex(pool, "@"); i >= 0 {
+		pool = pool[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(pool); err == nil {
+		pool = host
+	}
+	return strings.TrimSuffix(strings.ToLower(pool), ".")
+}
+
+// poolMatches returns true if the pool URL is on the expected host or one of its subdomains.
+func poolMatches(pool, expected string) bool {
+	host := poolHost(pool)
+	return host != "" && (host == expected || strings.HasSuffix(host, "."+expected))
+}
+
+// NewPoolThreshold is a critical threshold failing when any pool configured on the miner isn't on one of the comma
+// separated expected pool hosts or their subdomains e.g. nanopool.org.
+func NewPoolThreshold(pools string, causeReboot, sendEmail bool) (*Threshold, error) {
+	var expected []string
+	for _, pool := range strings.Split(pools, ",") {
+		if pool = poolHost(pool); pool != "" {
+			expected = append(expected, pool)
+		}
+	}
+	if len(expected) == 0 {
+		return nil, fmt.Errorf("no expected pools in %s", pools)
+	}
+	return &Threshold{
+		Check: func(stats *Statistics) []error {
+			if errors := poolsUnreadable(stats); errors != nil {
+				return errors
+			}
+			var errors []error
+			for _, pool := range stats.Pools {
+				found := false
+				for _, host := range expected {
+					found = found || poolMatches(pool.URL, host)
+				}
+				if !found {
+					errors = append(errors, fmt.Errorf("unexpected pool %s configured", pool.URL))
+				}
+			}
+			return errors
+		},
+		Threshold:   pools,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Critical:    true,
+		Name:        "Pool",
+	}, nil
+}
+
+type revenueSample struct {
+	at     time.Time
+	perDay float64
+}
+
+// NewRevenueDropThreshold compares the percentage the revenue per day has dropped by from its average over the
+// preceding window, e.g. >20 is exceeded when revenue falls 20% below its average, whether due to the hashrate or the coin
+// price. It is not checked until the window has been filled.
+func NewRevenueDropThreshold(threshold string, window time.Duration, causeReboot, sendEmail bool) (*Threshold, error) {
+	comp, number, err := parseFloatThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	var samples []revenueSample
+	var first time.Time
+	t := &Threshold{
+		Threshold:   threshold,
+		CauseReboot: causeReboot,
+		SendEmail:   sendEmail,
+		Name:        "RevenueDrop",
+	}
+	t.Check = func(stats *Statistics) []error {
+		if stats.Revenue == nil {
+			return nil
+		}
+		now := t.now()
+		if first.IsZero() {
+			first = now
+		}
+		for len(samples) > 0 && now.Sub(samples[0].at) > window {
+			samples = samples[1:]
+		}
+		average := 0.0
+		for _, s := range samples {
+			average += s.perDay
+		}
+		if len(samples) > 0 {
+			average /= float64(len(samples))
+		}
+		samples = append(samples, revenueSample{at: now, perDay: stats.Revenue.PerDay})
+		if now.Sub(first) < window || average <= 0 {
+			return nil
+		}
+		drop := (average - stats.Revenue.PerDay) / average * 100
+		glog.V(2).Infof("revenue %0.2f %s per day, %0.2f%% below the %v average %0.2f", stats.Revenue.PerDay, stats.Revenue.Currency, drop, window, average)
+		if comp(drop, number) {
+			return []error{fmt.Errorf("revenue drop threshold exceeded %0.2f%%%s, %0.2f %s per day against a %v average of %0.2f",
+				drop, threshold, stats.Revenue.PerDay, stats.Revenue.Currency, window, average)}
+		}
+		return nil
+	}
+	return t, nil
+}
@@ -7,3 +7,45 @@ func fmtErrors(errors []error) string {
 	}
 	return msg
 }
+
+// setFloatAt sets s[i] to v, growing s as needed.
+func setFloatAt(s []float64, i int, v float64) []float64 {
+	for len(s) <= i {
+		s = append(s, 0)
+	}
+	s[i] = v
+	return s
+}
+
+// setStringAt sets s[i] to v, growing s as needed.
+func setStringAt(s []string, i int, v string) []string {
+	for len(s) <= i {
+		s = append(s, "")
+	}
+	s[i] = v
+	return s
+}
+
+// stringAt returns s[i], or "" if s is too short.
+func stringAt(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
+}
+
+// setMinFloatAt sets s[i] to v if it is lower than the current value or no value has been set, growing s as needed.
+func setMinFloatAt(s []float64, i int, v float64) []float64 {
+	if current := floatAt(s, i); current != 0 && current < v {
+		return s
+	}
+	return setFloatAt(s, i, v)
+}
+
+// floatAt returns s[i], or 0 if s is too short.
+func floatAt(s []float64, i int) float64 {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "fmt"
+
+func isWindowsService() (bool, error) {
+	return false, nil
+}
+
+func runServiceCommand(command string, args []string) error {
+	return fmt.Errorf("service commands are only supported on Windows")
+}
+
+func runService() {}
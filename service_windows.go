@@ -0,0 +1,190 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mchestr/ethos-monitor/mining_monitor"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "MiningMonitor"
+	serviceDisplayName = "Mining Monitor"
+	serviceDescription = "Polls mining rigs for statistics and reboots or power cycles them when things go wrong"
+	serviceEventID     = 1
+)
+
+func isWindowsService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+func runServiceCommand(command string, args []string) error {
+	switch command {
+	case "install":
+		return installService(args)
+	case "remove":
+		return removeService()
+	case "start":
+		return startService()
+	case "stop":
+		return controlService(svc.Stop, svc.Stopped)
+	default:
+		return fmt.Errorf("unknown command %s, must be one of install|remove|start|stop", command)
+	}
+}
+
+// installService registers the running executable as an automatically started service, which is run with args.
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %s", err)
+	}
+	return nil
+}
+
+func removeService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	return eventlog.Remove(serviceName)
+}
+
+func startService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %s", serviceName, err)
+	}
+	defer s.Close()
+	return s.Start()
+}
+
+func controlService(c svc.Cmd, to svc.State) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %s", serviceName, err)
+	}
+	defer s.Close()
+	status, err := s.Control(c)
+	if err != nil {
+		return err
+	}
+	timeout := time.Now().Add(30 * time.Second)
+	for status.State != to {
+		if time.Now().After(timeout) {
+			return fmt.Errorf("timed out waiting for service %s to reach state %d", serviceName, to)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventLogSink writes monitoring events to the Windows event log.
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+func (s eventLogSink) Handle(e mining_monitor.Event) error {
+	switch e.Type {
+	case mining_monitor.LogType:
+		return s.log.Info(serviceEventID, fmt.Sprintf("[%s]: %s", e.Client.IP(), e.Message))
+	case mining_monitor.ErrorType:
+		return s.log.Error(serviceEventID, fmt.Sprintf("[%s] Error: %s", e.Client.IP(), e.Error))
+	case mining_monitor.EmailType:
+		return s.log.Warning(serviceEventID, fmt.Sprintf("[%s] %s: %s", e.Client.IP(), e.Subject, e.Message))
+	}
+	return nil
+}
+
+type monitorService struct {
+	log *eventlog.Log
+}
+
+func (s *monitorService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	defer func() {
+		if err := recover(); err != nil {
+			s.log.Error(serviceEventID, fmt.Sprintf("mining monitor failed: %s", err))
+			svcSpecificEC, exitCode = true, 1
+		}
+	}()
+	m, _, closers := newMonitor()
+	m.EventService.AddSink(eventLogSink{log: s.log})
+	if err := startMonitor(m); err != nil {
+		panic(err)
+	}
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for req := range r {
+		switch req.Cmd {
+		case svc.Interrogate:
+			changes <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending, WaitHint: uint32(drainTimeout.Milliseconds())}
+			drainMonitor(m, closers)
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func runService() {
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		panic(err)
+	}
+	defer elog.Close()
+	if err := svc.Run(serviceName, &monitorService{log: elog}); err != nil {
+		elog.Error(serviceEventID, fmt.Sprintf("%s service failed: %s", serviceName, err))
+	}
+}